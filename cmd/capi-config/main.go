@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"os"
+
 	"go.klusters.dev/capi-config/pkg/cmds"
 
 	"gomodules.xyz/logs"
@@ -30,5 +32,7 @@ func main() {
 
 	if err := rootCmd.Execute(); err != nil {
 		klog.Infoln("error:", err)
+		logs.FlushLogs()
+		os.Exit(1)
 	}
 }
@@ -20,11 +20,12 @@ export CGO_ENABLED=1
 export GO111MODULE=on
 export GOFLAGS="-mod=vendor"
 
-GINKGO_ARGS=${GINKGO_ARGS:-}
 TEST_ARGS=${TEST_ARGS:-}
-DOCKER_REGISTRY=${DOCKER_REGISTRY:-}
 
+# The e2e tests need clusterctl, kubectl and a kind management cluster
+# initialized with clusterctl init --infrastructure docker. They are
+# configured with the E2E_* environment variables, see test/e2e.
 echo "Running e2e tests:"
-cmd="ginkgo -r --v -race --progress --trace --noisyPendings=false ${GINKGO_ARGS} test -- --docker-registry=${DOCKER_REGISTRY} ${TEST_ARGS}"
+cmd="go test -tags e2e -count=1 -timeout 30m -v ${TEST_ARGS} ./test/e2e/..."
 echo $cmd
 $cmd
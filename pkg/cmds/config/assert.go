@@ -0,0 +1,99 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fieldRef points at a nested field of every resource of a kind. It is
+// written as Kind:dotted.path, where Kind may be an alias.
+type fieldRef struct {
+	kind string
+	path []string
+}
+
+func parseFieldRef(s string) (fieldRef, error) {
+	kind, path, ok := strings.Cut(s, ":")
+	if !ok || path == "" {
+		return fieldRef{}, fmt.Errorf("invalid field reference %q, expected Kind:dotted.path", s)
+	}
+	kind, err := resolveKind(kind)
+	if err != nil {
+		return fieldRef{}, err
+	}
+	return fieldRef{kind: kind, path: strings.Split(path, ".")}, nil
+}
+
+func (r fieldRef) String() string {
+	return r.kind + ":" + strings.Join(r.path, ".")
+}
+
+type assertion struct {
+	field fieldRef
+	value string
+
+	matched bool
+}
+
+func parseAssertion(s string) (*assertion, error) {
+	ref, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid assertion %q, expected Kind:path=value", s)
+	}
+	field, err := parseFieldRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	return &assertion{field: field, value: value}, nil
+}
+
+// check verifies the assertion on obj, if obj is of the asserted kind.
+func (a *assertion) check(obj *unstructured.Unstructured) error {
+	if obj.GetKind() != a.field.kind {
+		return nil
+	}
+	a.matched = true
+
+	actual, found, err := unstructured.NestedFieldNoCopy(obj.UnstructuredContent(), a.field.path...)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("assertion %s=%s failed on %s/%s: field not found", a.field, a.value, obj.GetKind(), obj.GetName())
+	}
+	if s := fieldString(actual); s != a.value {
+		return fmt.Errorf("assertion %s=%s failed on %s/%s: actual value %s", a.field, a.value, obj.GetKind(), obj.GetName(), s)
+	}
+	return nil
+}
+
+// fieldString returns strings as is and any other value JSON encoded.
+func fieldString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
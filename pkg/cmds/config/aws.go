@@ -0,0 +1,165 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+)
+
+// verifyAWSRoles checks that the IAM roles exist, using the credentials of
+// the default AWS credential chain. The check is skipped with a warning when
+// no credentials are available.
+func verifyAWSRoles(ctx context.Context, w *warnings, roles ...string) error {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		w.add("skipping IAM role verification: %v", err)
+		return nil
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		w.add("skipping IAM role verification, no AWS credentials available: %v", err)
+		return nil
+	}
+
+	client := iam.NewFromConfig(cfg)
+	var missing []string
+	for _, role := range roles {
+		if role == "" {
+			continue
+		}
+		_, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(role)})
+		var notFound *iamtypes.NoSuchEntityException
+		if errors.As(err, &notFound) {
+			missing = append(missing, role)
+		} else if err != nil {
+			return fmt.Errorf("failed to get IAM role %s: %w", role, err)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("IAM roles not found: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ec2VCPUQuotaCodes maps the instance classes, the leading letters of the
+// instance family, to the Service Quotas code of their running On-Demand
+// vCPU quota.
+var ec2VCPUQuotaCodes = map[string]string{
+	"a": "L-1216C47A", "c": "L-1216C47A", "d": "L-1216C47A", "h": "L-1216C47A", "i": "L-1216C47A",
+	"m": "L-1216C47A", "r": "L-1216C47A", "t": "L-1216C47A", "z": "L-1216C47A",
+	"g": "L-DB2E81BA", "vt": "L-DB2E81BA",
+	"p":   "L-417A185B",
+	"x":   "L-7295265B",
+	"f":   "L-74FC7D96",
+	"inf": "L-1945791B",
+	"trn": "L-2C3B7624",
+}
+
+// nodePoolCapacity is the instance type and maximum size of a machine pool.
+type nodePoolCapacity struct {
+	pool         string
+	instanceType string
+	maxSize      int64
+}
+
+// checkAWSQuotas checks that the machine pools at their maximum size fit
+// within the running On-Demand vCPU quotas of the region, using the
+// credentials of the default AWS credential chain. Pools sharing a quota
+// are added up. Every exceeded quota is added to w. The check is skipped
+// with a warning when no credentials are available.
+func checkAWSQuotas(ctx context.Context, w *warnings, region string, pools []nodePoolCapacity) error {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		w.add("skipping quota check: %v", err)
+		return nil
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		w.add("skipping quota check, no AWS credentials available: %v", err)
+		return nil
+	}
+
+	ec2Client := ec2.NewFromConfig(cfg)
+	vcpus := make(map[string]int64)
+	needed := make(map[string]int64)
+	users := make(map[string][]string)
+	var codes []string
+	for _, p := range pools {
+		code, ok := ec2VCPUQuotaCodes[instanceClass(p.instanceType)]
+		if !ok {
+			w.add("skipping quota check of %s, no vCPU quota known for instance type %q", p.pool, p.instanceType)
+			continue
+		}
+		if _, ok := vcpus[p.instanceType]; !ok {
+			out, err := ec2Client.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+				InstanceTypes: []ec2types.InstanceType{ec2types.InstanceType(p.instanceType)},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get instance type %s: %w", p.instanceType, err)
+			}
+			if len(out.InstanceTypes) == 0 || out.InstanceTypes[0].VCpuInfo == nil {
+				return fmt.Errorf("failed to get vCPUs of instance type %s", p.instanceType)
+			}
+			vcpus[p.instanceType] = int64(aws.ToInt32(out.InstanceTypes[0].VCpuInfo.DefaultVCpus))
+		}
+		if _, ok := needed[code]; !ok {
+			codes = append(codes, code)
+		}
+		needed[code] += p.maxSize * vcpus[p.instanceType]
+		users[code] = append(users[code], p.pool)
+	}
+
+	sqClient := servicequotas.NewFromConfig(cfg)
+	for _, code := range codes {
+		out, err := sqClient.GetServiceQuota(ctx, &servicequotas.GetServiceQuotaInput{
+			ServiceCode: aws.String("ec2"),
+			QuotaCode:   aws.String(code),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get service quota %s: %w", code, err)
+		}
+		limit := int64(aws.ToFloat64(out.Quota.Value))
+		if needed[code] > limit {
+			w.add("machine pools %s need up to %d vCPUs, more than the %s quota of %d vCPUs in %s",
+				strings.Join(users[code], ", "), needed[code], aws.ToString(out.Quota.QuotaName), limit, cfg.Region)
+		}
+	}
+	return nil
+}
+
+// instanceClass returns the leading letters of the instance family of the
+// instance type, e.g. m for m6g.large and inf for inf2.xlarge.
+func instanceClass(instanceType string) string {
+	if i := strings.IndexFunc(instanceType, unicode.IsDigit); i >= 0 {
+		return instanceType[:i]
+	}
+	return instanceType
+}
@@ -0,0 +1,74 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kmodules.xyz/client-go/tools/parser"
+	"sigs.k8s.io/yaml"
+)
+
+func TestPreserveBlockScalars(t *testing.T) {
+	in, err := os.ReadFile("testdata/cloud-init.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]any
+	if err := yaml.Unmarshal(in, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  ioOptions
+		block bool
+	}{
+		{name: "default", opts: ioOptions{}},
+		{name: "preserve block scalars", opts: ioOptions{preserveBlockScalars: true}, block: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []byte
+			err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+				var err error
+				out, err = tt.opts.marshal(ri.Object)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(out), "content: |"); got != tt.block {
+				t.Errorf("block scalar in output = %v, want %v:\n%s", got, tt.block, out)
+			}
+			if !strings.Contains(string(out), "content: capi-md-0\n") {
+				t.Errorf("single-line content is not a plain scalar:\n%s", out)
+			}
+
+			var got map[string]any
+			if err := yaml.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip changed the document:\n%s", out)
+			}
+		})
+	}
+}
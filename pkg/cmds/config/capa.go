@@ -17,17 +17,21 @@ limitations under the License.
 package config
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"kmodules.xyz/client-go/tools/parser"
-	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -35,198 +39,1298 @@ const (
 	awsManagedMachinePoolKind  = "AWSManagedMachinePool"
 	machinePoolKind            = "MachinePool"
 	clusterKind                = "Cluster"
+	awsClusterKind             = "AWSCluster"
 	controlplaneRoleAnnotation = "eks.amazonaws.com/controlplane-role"
 	machinepoolRoleAnnotation  = "eks.amazonaws.com/machinepool-role"
+	subnetRoleTag              = "sigs.k8s.io/cluster-api-provider-aws/role"
+
+	latestAWSManagedCPAPIVersion = "controlplane.cluster.x-k8s.io/v1beta2"
+)
+
+var (
+	awsRegionRegex          = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+	awsVPCIDRegex           = regexp.MustCompile(`^vpc-([0-9a-f]{8}|[0-9a-f]{17})$`)
+	awsInternetGatewayRegex = regexp.MustCompile(`^igw-([0-9a-f]{8}|[0-9a-f]{17})$`)
+	// gravitonInstanceRegex matches the instance families of AWS Graviton
+	// (arm64) processors, e.g. m6g, c7gn and t4g.
+	gravitonInstanceRegex = regexp.MustCompile(`^[a-z]+[0-9]+g[a-z]*\.`)
+	eksClusterNameRegex   = regexp.MustCompile(`^[0-9A-Za-z][A-Za-z0-9_-]{0,99}$`)
+	eksVersionRegex       = regexp.MustCompile(`^v?1\.[0-9]+(\.[0-9]+)?$`)
+	vpcCNIVersionRegex    = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+(-eksbuild\.[0-9]+)?$`)
+	envNameRegex          = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
 )
 
+// awsManagedCPNetworkPaths maps the known AWSManagedControlPlane apiVersions
+// to the path of their network spec, which was called networkSpec before
+// v1alpha4.
+var awsManagedCPNetworkPaths = map[string][]string{
+	"controlplane.cluster.x-k8s.io/v1alpha3": {"spec", "networkSpec"},
+	"controlplane.cluster.x-k8s.io/v1alpha4": {"spec", "network"},
+	"controlplane.cluster.x-k8s.io/v1beta1":  {"spec", "network"},
+	"controlplane.cluster.x-k8s.io/v1beta2":  {"spec", "network"},
+}
+
+// awsManagedCPNetworkPath returns the network spec path for the apiVersion of
+// ri, falling back to the latest known apiVersion.
+func awsManagedCPNetworkPath(ri *parser.ResourceInfo, fields ...string) []string {
+	path, ok := awsManagedCPNetworkPaths[ri.Object.GetAPIVersion()]
+	if !ok {
+		path = awsManagedCPNetworkPaths[latestAWSManagedCPAPIVersion]
+	}
+	return append(append([]string{}, path...), fields...)
+}
+
 func setAWSManagedCPCIDR(ri *parser.ResourceInfo, vpcCidr string) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
 	netcfg := map[string]any{
 		"vpc": map[string]any{
 			"cidrBlock": vpcCidr,
 		},
 	}
-	if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), netcfg, "spec", "network"); err != nil {
+	if err := setField(*ri, netcfg, awsManagedCPNetworkPath(ri)...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// setAWSManagedCPAZUsageLimit limits the number of availability zones the
+// subnets of an auto-created VPC are spread across.
+func setAWSManagedCPAZUsageLimit(ri *parser.ResourceInfo, limit int64) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
+	return setField(*ri, limit, awsManagedCPNetworkPath(ri, "vpc", "availabilityZoneUsageLimit")...)
+}
+
+// setAWSManagedCPVPC makes the control plane use an existing VPC and,
+// if igwID is given, its existing internet gateway.
+func setAWSManagedCPVPC(ri *parser.ResourceInfo, vpcID, igwID string) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
+	if err := setField(*ri, vpcID, awsManagedCPNetworkPath(ri, "vpc", "id")...); err != nil {
+		return err
+	}
+	if igwID != "" {
+		return setField(*ri, igwID, awsManagedCPNetworkPath(ri, "vpc", "internetGatewayId")...)
+	}
+	return nil
+}
+
+// setAWSManagedCPNATGatewayMode selects between a single NAT gateway shared
+// by all availability zones and one NAT gateway per availability zone.
+func setAWSManagedCPNATGatewayMode(ri *parser.ResourceInfo, mode string) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
+	return setField(*ri, mode, awsManagedCPNetworkPath(ri, "vpc", "natGatewayMode")...)
+}
+
+// parseVPCCNIEnv parses env vars in NAME=value format, keeping their order.
+func parseVPCCNIEnv(envs []string) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(envs))
+	for _, s := range envs {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || !envNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid VPC CNI env %q, expected NAME=value", s)
+		}
+		out = append(out, map[string]any{
+			"name":  name,
+			"value": value,
+		})
+	}
+	return out, nil
+}
+
+// setAWSManagedCPVPCCNI sets the VPC CNI version and merges env into its
+// env vars, replacing the value of the env vars that already exist.
+func setAWSManagedCPVPCCNI(ri *parser.ResourceInfo, version string, env []interface{}) error {
+	if version != "" {
+		if err := setField(*ri, version, "spec", "vpcCni", "version"); err != nil {
+			return err
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	existing, _, err := unstructured.NestedSlice(ri.Object.UnstructuredContent(), "spec", "vpcCni", "env")
+	if err != nil {
+		return fmt.Errorf("failed to get spec.vpcCni.env of %s: %w", ri.Object.GetKind(), err)
+	}
+	for _, e := range env {
+		var found bool
+		for i, cur := range existing {
+			if m, ok := cur.(map[string]any); ok && m["name"] == e.(map[string]any)["name"] {
+				existing[i], found = e, true
+			}
+		}
+		if !found {
+			existing = append(existing, e)
+		}
+	}
+	return setField(*ri, existing, "spec", "vpcCni", "env")
+}
+
+// setAWSManagedCPVPCTags merges tags into the tags of the VPC.
+func setAWSManagedCPVPCTags(ri *parser.ResourceInfo, tags map[string]string) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
+	for k, v := range tags {
+		if err := setField(*ri, v, awsManagedCPNetworkPath(ri, "vpc", "tags", k)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAWSManagedCPSubnets sets the subnets of a three tier VPC layout, after
+// the plain subnets without a tier. The role tags tell CAPA and the AWS load
+// balancer controller which subnets to use for internet-facing and internal
+// load balancers.
+func setAWSManagedCPSubnets(ri *parser.ResourceInfo, plain, public, private, intra []string) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
+	var subnets []interface{}
+	for _, cidr := range plain {
+		subnets = append(subnets, map[string]any{
+			"cidrBlock": cidr,
+		})
+	}
+	for _, cidr := range public {
+		subnets = append(subnets, map[string]any{
+			"cidrBlock": cidr,
+			"isPublic":  true,
+			"tags": map[string]any{
+				subnetRoleTag:            "public",
+				"kubernetes.io/role/elb": "1",
+			},
+		})
+	}
+	for _, cidr := range private {
+		subnets = append(subnets, map[string]any{
+			"cidrBlock": cidr,
+			"isPublic":  false,
+			"tags": map[string]any{
+				subnetRoleTag:                     "private",
+				"kubernetes.io/role/internal-elb": "1",
+			},
+		})
+	}
+	for _, cidr := range intra {
+		subnets = append(subnets, map[string]any{
+			"cidrBlock": cidr,
+			"isPublic":  false,
+			"tags": map[string]any{
+				subnetRoleTag: "intra",
+			},
+		})
+	}
+	if err := setField(*ri, subnets, awsManagedCPNetworkPath(ri, "subnets")...); err != nil {
 		return err
 	}
 	return nil
 }
 
-func setAWSManagedMPScaling(ri *parser.ResourceInfo, name string, minNodeCount, maxNodeCount int64) error {
-	scaling := map[string]any{
-		"minSize": minNodeCount,
-		"maxSize": maxNodeCount,
+func setAWSManagedMPScaling(ri *parser.ResourceInfo, name string, minNodeCount, maxNodeCount, desiredNodeCount int64, w *warnings) error {
+	if skipped(ri.Object, skipScaling) {
+		return setName(*ri, name, w)
+	}
+	if err := setField(*ri, minNodeCount, "spec", "scaling", "minSize"); err != nil {
+		return err
 	}
-	if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), scaling, "spec", "scaling"); err != nil {
+	if err := setField(*ri, maxNodeCount, "spec", "scaling", "maxSize"); err != nil {
 		return err
 	}
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), name, "metadata", "name"); err != nil {
+	if desiredNodeCount > 0 {
+		if err := setField(*ri, desiredNodeCount, "spec", "scaling", "desiredSize"); err != nil {
+			return err
+		}
+	}
+	if err := setName(*ri, name, w); err != nil {
+		return err
+	}
+	return nil
+}
+
+// warnReplicasOutsideBounds warns if replicas is outside the bounds of the
+// cluster autoscaler annotations of a MachinePool, in which case the
+// autoscaler overrides it.
+func warnReplicasOutsideBounds(ri parser.ResourceInfo, replicas int64, w *warnings) {
+	annotations := ri.Object.GetAnnotations()
+	minSize, err := strconv.ParseInt(annotations[autoscalerMinSizeAnnotation], 10, 64)
+	if err == nil && replicas < minSize {
+		w.add("%s %s replicas %d is below the autoscaler min size %d, the cluster autoscaler will override it", machinePoolKind, resourceName(ri), replicas, minSize)
+		return
+	}
+	maxSize, err := strconv.ParseInt(annotations[autoscalerMaxSizeAnnotation], 10, 64)
+	if err == nil && replicas > maxSize {
+		w.add("%s %s replicas %d is above the autoscaler max size %d, the cluster autoscaler will override it", machinePoolKind, resourceName(ri), replicas, maxSize)
+	}
+}
+
+// checkAWSManagedMPRegion returns an error if the machine pool explicitly
+// uses a region other than the control plane region, either with a region
+// field or with availability zones of another region.
+func checkAWSManagedMPRegion(ri *parser.ResourceInfo, region string) error {
+	if r, ok, _ := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "region"); ok && r != region {
+		return fmt.Errorf("%s %s has region %q, which conflicts with control plane region %q", awsManagedMachinePoolKind, resourceName(*ri), r, region)
+	}
+	zones, _, _ := unstructured.NestedStringSlice(ri.Object.UnstructuredContent(), "spec", "availabilityZones")
+	for _, zone := range zones {
+		if !strings.HasPrefix(zone, region) {
+			return fmt.Errorf("%s %s availability zone %q is not in control plane region %q", awsManagedMachinePoolKind, resourceName(*ri), zone, region)
+		}
+	}
+	return nil
+}
+
+// amiTypes maps the EKS AMI families to their AMI type per architecture.
+var amiTypes = map[string]map[string]string{
+	"AL2": {
+		"amd64": "AL2_x86_64",
+		"arm64": "AL2_ARM_64",
+	},
+	"AL2023": {
+		"amd64": "AL2023_x86_64_STANDARD",
+		"arm64": "AL2023_ARM_64_STANDARD",
+	},
+	"BOTTLEROCKET": {
+		"amd64": "BOTTLEROCKET_x86_64",
+		"arm64": "BOTTLEROCKET_ARM_64",
+	},
+}
+
+// setAWSManagedMPArchitecture sets the AMI type of the machine pool to the
+// architecture, keeping the AMI family of the current AMI type, AL2 if
+// there is none. It warns if the instance type is built for another
+// architecture.
+func setAWSManagedMPArchitecture(ri *parser.ResourceInfo, arch string, w *warnings) error {
+	current, _, _ := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "amiType")
+	family := "AL2"
+	if current != "" {
+		f, _, _ := strings.Cut(current, "_")
+		if _, ok := amiTypes[f]; !ok {
+			return fmt.Errorf("%s %s has AMI type %q, which has no %s variant", awsManagedMachinePoolKind, resourceName(*ri), current, arch)
+		}
+		family = f
+	}
+	if err := setField(*ri, amiTypes[family][arch], "spec", "amiType"); err != nil {
 		return err
 	}
+
+	instanceType, _, _ := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "instanceType")
+	if instanceType != "" && gravitonInstanceRegex.MatchString(instanceType) != (arch == "arm64") {
+		w.add("%s %s instance type %q doesn't match architecture %s", awsManagedMachinePoolKind, resourceName(*ri), instanceType, arch)
+	}
 	return nil
 }
 
-func setAWSClusterAnnotations(ri *parser.ResourceInfo, managedControlplaneRole, managedMachinepoolRole string) error {
+// eksClusterNames returns the name of the Cluster of every
+// AWSManagedControlPlane of in, which is the Cluster referencing it as
+// control plane or else the only Cluster of in.
+func eksClusterNames(in []byte) (map[string]string, error) {
+	var clusters []string
+	byControlPlane := make(map[string]string)
+	err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if ri.Object.GetKind() != clusterKind {
+			return nil
+		}
+		clusters = append(clusters, ri.Object.GetName())
+		ref, _, _ := unstructured.NestedStringMap(ri.Object.UnstructuredContent(), "spec", "controlPlaneRef")
+		if ref["kind"] == awsManagedControlPlaneKind {
+			byControlPlane[ref["name"]] = ri.Object.GetName()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(clusters) == 0 {
+		return nil, errors.New("failed to get Cluster to derive the EKS cluster name")
+	}
+
+	names := make(map[string]string)
+	err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if ri.Object.GetKind() != awsManagedControlPlaneKind {
+			return nil
+		}
+		name, ok := byControlPlane[ri.Object.GetName()]
+		if !ok {
+			if len(clusters) > 1 {
+				return fmt.Errorf("failed to get Cluster of %s %s, none of the Clusters %s references it", awsManagedControlPlaneKind, ri.Object.GetName(), strings.Join(clusters, ", "))
+			}
+			name = clusters[0]
+		}
+		if !eksClusterNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid EKS cluster name %q derived from the Cluster name, expected up to 100 alphanumeric characters, hyphens and underscores, starting with an alphanumeric character", name)
+		}
+		names[ri.Object.GetName()] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// setAWSRoleName sets the IAM role of an AWSManagedControlPlane or
+// AWSManagedMachinePool, unless role is empty.
+func setAWSRoleName(ri *parser.ResourceInfo, role string) error {
+	if role == "" {
+		return nil
+	}
+	return setField(*ri, role, "spec", "roleName")
+}
+
+func setAWSClusterAnnotations(ri *parser.ResourceInfo, controlplaneRoleKey, managedControlplaneRole, managedMachinepoolRole string) error {
 	if managedControlplaneRole != "" {
-		if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), managedControlplaneRole, "metadata", "annotations", controlplaneRoleAnnotation); err != nil {
+		if err := setField(*ri, managedControlplaneRole, "metadata", "annotations", controlplaneRoleKey); err != nil {
 			return err
 		}
 	}
 	if managedMachinepoolRole != "" {
-		if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), managedMachinepoolRole, "metadata", "annotations", machinepoolRoleAnnotation); err != nil {
+		if err := setField(*ri, managedMachinepoolRole, "metadata", "annotations", machinepoolRoleAnnotation); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// machinePoolInfraRef is the infrastructureRef of a MachinePool, as found
+// in the input.
+type machinePoolInfraRef struct {
+	pool, kind, name string
+}
+
 type validationHelper struct {
 	isFound                 map[string]bool
+	excluded                map[string]bool
 	managedControlplaneRole string
 	managedMachinepoolRole  string
 	vpcCidr                 string
+	podSecondaryCidr        string
+	hasSubnets              bool
+	azUsageLimit            int64
+	region                  string
+	natGatewayMode          string
+	vpcID                   string
+	internetGatewayID       string
+	lbScheme, lbType        string
+	hasTags                 bool
+	hasVPCTags              bool
+	hasRootVolume           bool
+	architecture            string
+	eksVersion              string
+	hasVPCCNI               bool
+	instanceType            string
 	minCount, maxCount      int64
+	desiredCount            int64
+}
+
+// validationRule is a rule enforced by validation. rule describes it for
+// --explain-validation and check returns the error if it is violated.
+type validationRule struct {
+	rule  string
+	check func(h validationHelper) error
+}
+
+// requireKinds returns a rule requiring one of kinds in the input when
+// isSet reports that flags are set.
+func requireKinds(flags string, isSet func(h validationHelper) bool, msg string, kinds ...string) validationRule {
+	return validationRule{
+		rule: fmt.Sprintf("%s: needs %s in the input", flags, kindList(kinds)),
+		check: func(h validationHelper) error {
+			if !isSet(h) {
+				return nil
+			}
+			for _, kind := range kinds {
+				if h.isFound[kind] {
+					return nil
+				}
+			}
+			return errors.New(msg)
+		},
+	}
+}
+
+// requireRoleKinds is requireKinds for the roles, which are always set from
+// the environment. Kinds left out by --selector or --name don't need them.
+func requireRoleKinds(flags string, isSet func(h validationHelper) bool, msg string, kinds ...string) validationRule {
+	r := requireKinds(flags, isSet, msg, kinds...)
+	r.rule += " unless left out by --selector or --name"
+	check := r.check
+	r.check = func(h validationHelper) error {
+		for _, kind := range kinds {
+			if h.excluded[kind] {
+				return nil
+			}
+		}
+		return check(h)
+	}
+	return r
+}
+
+func kindList(kinds []string) string {
+	if len(kinds) == 1 {
+		return kinds[0]
+	}
+	return "one of " + strings.Join(kinds, ", ")
+}
+
+func sortedKinds(paths map[string][]string) []string {
+	kinds := make([]string, 0, len(paths))
+	for kind := range paths {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
 }
 
+// flagRules only depend on the flags and are checked by validateFlags
+// before any resource is processed, even with --stream. Violations are
+// reported in this order.
+var flagRules = []validationRule{
+	{
+		rule: "--vpc-id: must match " + awsVPCIDRegex.String(),
+		check: func(h validationHelper) error {
+			if h.vpcID != "" && !awsVPCIDRegex.MatchString(h.vpcID) {
+				return fmt.Errorf("invalid VPC id %q", h.vpcID)
+			}
+			return nil
+		},
+	},
+	{
+		rule: "--internet-gateway-id: needs --vpc-id and must match " + awsInternetGatewayRegex.String(),
+		check: func(h validationHelper) error {
+			if h.internetGatewayID == "" {
+				return nil
+			}
+			if h.vpcID == "" {
+				return errors.New("--internet-gateway-id requires --vpc-id")
+			}
+			if !awsInternetGatewayRegex.MatchString(h.internetGatewayID) {
+				return fmt.Errorf("invalid internet gateway id %q", h.internetGatewayID)
+			}
+			return nil
+		},
+	},
+	{
+		rule: "--nat-gateway-mode: must be single or per-az",
+		check: func(h validationHelper) error {
+			switch h.natGatewayMode {
+			case "", "single", "per-az":
+				return nil
+			}
+			return fmt.Errorf("invalid NAT gateway mode %q, expected single or per-az", h.natGatewayMode)
+		},
+	},
+	{
+		rule: "--region: must match " + awsRegionRegex.String(),
+		check: func(h validationHelper) error {
+			if h.region != "" && !awsRegionRegex.MatchString(h.region) {
+				return fmt.Errorf("invalid region %q", h.region)
+			}
+			return nil
+		},
+	},
+	{
+		rule: "--az-usage-limit: must be 1 to 6",
+		check: func(h validationHelper) error {
+			if h.azUsageLimit != 0 && (h.azUsageLimit < 1 || h.azUsageLimit > 6) {
+				return fmt.Errorf("invalid availability zone usage limit %d, expected 1 to 6", h.azUsageLimit)
+			}
+			return nil
+		},
+	},
+	{
+		rule: "--lb-scheme: must be internet-facing or internal",
+		check: func(h validationHelper) error {
+			if h.lbScheme != "" && h.lbScheme != "internet-facing" && h.lbScheme != "internal" {
+				return fmt.Errorf("invalid load balancer scheme %q, expected internet-facing or internal", h.lbScheme)
+			}
+			return nil
+		},
+	},
+	{
+		rule: "--lb-type: must be one of classic, elb, alb, nlb or disabled",
+		check: func(h validationHelper) error {
+			switch h.lbType {
+			case "", "classic", "elb", "alb", "nlb", "disabled":
+				return nil
+			}
+			return fmt.Errorf("invalid load balancer type %q, expected one of classic, elb, alb, nlb or disabled", h.lbType)
+		},
+	},
+	{
+		rule: "--max-node-count: must not be less than --min-node-count",
+		check: func(h validationHelper) error {
+			if h.minCount > h.maxCount {
+				return errors.New("max node count can't be less than min node count")
+			}
+			return nil
+		},
+	},
+	{
+		rule: "--desired-node-count: must be between --min-node-count and --max-node-count",
+		check: func(h validationHelper) error {
+			if h.desiredCount > 0 && (h.desiredCount < h.minCount || h.desiredCount > h.maxCount) {
+				return errors.New("desired node count must be between min and max node count")
+			}
+			return nil
+		},
+	},
+	{
+		rule: "--architecture: must be amd64 or arm64",
+		check: func(h validationHelper) error {
+			if h.architecture != "" && h.architecture != "amd64" && h.architecture != "arm64" {
+				return fmt.Errorf("invalid architecture %q, expected amd64 or arm64", h.architecture)
+			}
+			return nil
+		},
+	},
+}
+
+// validationRules depend on the kinds of the input and are checked by
+// validation, violations are reported in this order.
+var validationRules = []validationRule{
+	requireKinds("VPC_CIDR", func(h validationHelper) bool { return h.vpcCidr != "" },
+		"failed to get AWSManagedControlPlane for cidr update", awsManagedControlPlaneKind),
+	requireRoleKinds("CONTROLPLANE_ROLE", func(h validationHelper) bool { return h.managedControlplaneRole != "" },
+		"failed to get AWSManagedControlPlane for role configuration", awsManagedControlPlaneKind),
+	requireKinds("--pod-secondary-cidr", func(h validationHelper) bool { return h.podSecondaryCidr != "" },
+		"failed to get AWSManagedControlPlane for pod secondary cidr configuration", awsManagedControlPlaneKind),
+	requireKinds("--subnet-cidr, --public-subnet-cidr, --private-subnet-cidr and --intra-subnet-cidr", func(h validationHelper) bool { return h.hasSubnets },
+		"failed to get AWSManagedControlPlane for subnet configuration", awsManagedControlPlaneKind),
+	requireKinds("--az-usage-limit", func(h validationHelper) bool { return h.azUsageLimit != 0 },
+		"failed to get AWSManagedControlPlane for availability zone usage limit", awsManagedControlPlaneKind),
+	requireKinds("--vpc-tag", func(h validationHelper) bool { return h.hasVPCTags },
+		"failed to get AWSManagedControlPlane for VPC tag configuration", awsManagedControlPlaneKind),
+	requireKinds("--vpc-id", func(h validationHelper) bool { return h.vpcID != "" },
+		"failed to get AWSManagedControlPlane for VPC configuration", awsManagedControlPlaneKind),
+	requireKinds("--nat-gateway-mode", func(h validationHelper) bool { return h.natGatewayMode != "" },
+		"failed to get AWSManagedControlPlane for NAT gateway configuration", awsManagedControlPlaneKind),
+	requireKinds("--eks-version", func(h validationHelper) bool { return h.eksVersion != "" },
+		"failed to get AWSManagedControlPlane for version configuration", awsManagedControlPlaneKind),
+	requireKinds("--vpc-cni-version and --vpc-cni-env", func(h validationHelper) bool { return h.hasVPCCNI },
+		"failed to get AWSManagedControlPlane for VPC CNI configuration", awsManagedControlPlaneKind),
+	requireKinds("--region", func(h validationHelper) bool { return h.region != "" },
+		"failed to get AWSManagedControlPlane for region configuration", awsManagedControlPlaneKind),
+	requireKinds("--lb-scheme and --lb-type", func(h validationHelper) bool { return h.lbScheme != "" || h.lbType != "" },
+		"failed to get AWSCluster for load balancer configuration", awsClusterKind),
+	requireKinds("--tag, --set-tags and --tag-profile", func(h validationHelper) bool { return h.hasTags },
+		"failed to get an AWS resource for tag configuration", sortedKinds(awsTagPaths)...),
+	requireKinds("--root-volume-size, --root-volume-type and --root-volume-iops", func(h validationHelper) bool { return h.hasRootVolume },
+		"failed to get AWSMachineTemplate or AWSMachinePool for root volume configuration", sortedKinds(awsRootVolumePaths)...),
+	requireKinds("--architecture", func(h validationHelper) bool { return h.architecture != "" },
+		"failed to get AWSManagedMachinePool for architecture configuration", awsManagedMachinePoolKind),
+	requireKinds("--instance-type", func(h validationHelper) bool { return h.instanceType != "" },
+		"failed to get AWSManagedMachinePool for instance type configuration", awsManagedMachinePoolKind),
+	requireRoleKinds("the machine pool role", func(h validationHelper) bool { return h.managedMachinepoolRole != "" },
+		"failed to get AWSManagedMachinePool for role configuration", awsManagedMachinePoolKind),
+	requireRoleKinds("CONTROLPLANE_ROLE and the machine pool role", func(h validationHelper) bool {
+		return h.managedControlplaneRole != "" || h.managedMachinepoolRole != ""
+	}, "failed to get Cluster Kind to update annotations", clusterKind),
+}
+
+// validateFlags checks every flag rule and returns the violations joined.
+func validateFlags(helper validationHelper) error {
+	return checkRules(flagRules, helper)
+}
+
+// validation checks every input rule and returns the violations joined.
 func validation(helper validationHelper) error {
-	if !helper.isFound[awsManagedControlPlaneKind] {
-		if helper.vpcCidr != "" {
-			return errors.New("failed to get AWSManagedControlPlane for cidr update")
+	return checkRules(validationRules, helper)
+}
+
+func checkRules(rules []validationRule, helper validationHelper) error {
+	var errs []error
+	for _, r := range rules {
+		if err := r.check(helper); err != nil {
+			errs = append(errs, err)
 		}
-		if helper.managedControlplaneRole != "" {
-			return errors.New("failed to get AWSManagedControlPlane for role configuration")
+	}
+	return errors.Join(errs...)
+}
+
+// explainValidation writes the rules checked by validateFlags and
+// validation to w.
+func explainValidation(w io.Writer) error {
+	for _, rules := range [][]validationRule{flagRules, validationRules} {
+		for _, r := range rules {
+			if _, err := fmt.Fprintf(w, "- %s\n", r.rule); err != nil {
+				return err
+			}
 		}
 	}
-	if helper.minCount > helper.maxCount {
-		return errors.New("max node count can't be less than min node count")
+	return nil
+}
+
+// CAPAOptions holds the configuration applied by ConfigureCAPA. Empty and
+// zero values leave the corresponding fields of the manifest untouched,
+// except for MinNodeCount and MaxNodeCount, which are always set.
+type CAPAOptions struct {
+	VPCCidr                 string
+	ClusterName             string
+	ManagedControlplaneRole string
+	ManagedMachinepoolRole  string
+	EBSCSIDriverVersion     string
+	NodeMachineType         string
+	// Architecture, amd64 or arm64, selects the AMI type of the machine
+	// pools within their AMI family.
+	Architecture     string
+	MinNodeCount     int64
+	MaxNodeCount     int64
+	DesiredNodeCount int64
+	// Replicas, if set, is the fixed replica count of the MachinePool.
+	Replicas           *int64
+	PodSecondaryCidr   string
+	SubnetCidrs        []string
+	PublicSubnetCidrs  []string
+	PrivateSubnetCidrs []string
+	IntraSubnetCidrs   []string
+	AZUsageLimit       int64
+	// InstanceType is the instance type of the machine pools. It takes
+	// precedence over NodeMachineType and requires an AWSManagedMachinePool.
+	InstanceType string
+	// RootVolumeSize in GiB, RootVolumeType and RootVolumeIOPS configure
+	// the root volume of AWSMachineTemplate and AWSMachinePool.
+	RootVolumeSize int64
+	RootVolumeType string
+	RootVolumeIOPS int64
+	// EKSVersion is the Kubernetes version of the control plane, like
+	// v1.29 or 1.29.
+	EKSVersion string
+	// VPCTags in key=value format are merged into the tags of the VPC,
+	// separate from the additional tags of the cluster.
+	VPCTags []string
+	// VPCCNIVersion is the version of the VPC CNI addon, like
+	// v1.18.1-eksbuild.1, and VPCCNIEnv its env vars in NAME=value format,
+	// merged with the existing ones.
+	VPCCNIVersion string
+	VPCCNIEnv     []string
+	// Region is set on the control plane. Machine pools must not use
+	// another region.
+	Region string
+	// NATGatewayMode is single or per-az.
+	NATGatewayMode string
+	// VPCID selects an existing VPC, and InternetGatewayID its internet
+	// gateway, which requires VPCID.
+	VPCID             string
+	InternetGatewayID string
+	LBScheme          string
+	LBType            string
+	// EKSClusterNameFromCluster sets spec.eksClusterName of the control
+	// plane to the name of its Cluster instead of ClusterName.
+	EKSClusterNameFromCluster bool
+	// ControlplaneRoleAnnotationKey is the Cluster annotation holding the
+	// control plane role, eks.amazonaws.com/controlplane-role if empty.
+	ControlplaneRoleAnnotationKey string
+	// Tags are merged into the additional tags of the AWS kinds, on top of
+	// the tags of TagProfile, one of dev, staging or prod.
+	Tags       map[string]string
+	TagProfile string
+	// ClearIdentityRef removes spec.identityRef from the AWS cluster kinds,
+	// e.g. when switching from static credentials to role based identity.
+	// With Strict it is an error if there is none to remove.
+	ClearIdentityRef bool
+	// IdentityNamespace is set as the namespace of the spec.identityRef of
+	// the AWS cluster kinds that reference an identity by name.
+	IdentityNamespace string
+	// Strict turns warnings into an error.
+	Strict bool
+	// VerifyAWSRoles checks that the control plane and machine pool IAM
+	// roles exist before the manifest is returned.
+	VerifyAWSRoles bool
+	// CheckQuotas checks that the machine pools at their maximum size fit
+	// within the vCPU quotas of the region. Exceeded quotas are warnings.
+	CheckQuotas bool
+	// Quiet suppresses warnings.
+	Quiet bool
+	// Selector, if set, limits the mutations to the resources with matching
+	// labels. The other resources are passed through unchanged.
+	Selector string
+	// Name, if set, limits the mutations to the resources of that name.
+	Name string
+	// OnChange, if set, is called for every field changed by the mutations.
+	OnChange ChangeFunc
+
+	coreOpts      *coreOptions
+	transformOpts *transformOptions
+	ioOpts        *ioOptions
+}
+
+// ConfigureCAPA applies opts to the CAPA manifest in and returns the
+// resulting manifest. The kinds found in the manifest are collected before
+// validation, so the order of the documents doesn't matter.
+func ConfigureCAPA(in []byte, opts CAPAOptions) ([]byte, error) {
+	coreOpts, transformOpts, ioOpts := opts.coreOpts, opts.transformOpts, opts.ioOpts
+	if coreOpts == nil {
+		coreOpts = &coreOptions{}
 	}
-	if helper.managedMachinepoolRole != "" && !helper.isFound[awsManagedMachinePoolKind] {
-		return errors.New("failed to get AWSManagedMachinePool for role configuration")
+	if transformOpts == nil {
+		transformOpts = &transformOptions{}
 	}
-	if !helper.isFound[clusterKind] {
-		if helper.managedControlplaneRole != "" || helper.managedMachinepoolRole != "" {
-			return errors.New("failed to get Cluster Kind to update annotations")
+	if ioOpts == nil {
+		ioOpts = &ioOptions{
+			outputFormat: outputFormatYAML,
+			fieldMode:    fieldModeCreateIfMissing,
+			failFast:     true,
 		}
 	}
-	return nil
+	coreOpts.reset()
+	transformOpts.reset()
+	w := &ioOpts.warnings
+	w.reset()
+
+	if opts.VPCCidr != "" {
+		if err := validateCIDR("vpc", opts.VPCCidr); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PodSecondaryCidr != "" {
+		if err := validateCIDR("pod secondary", opts.PodSecondaryCidr); err != nil {
+			return nil, err
+		}
+	}
+	for tier, cidrs := range map[string][]string{
+		"subnet":         opts.SubnetCidrs,
+		"public subnet":  opts.PublicSubnetCidrs,
+		"private subnet": opts.PrivateSubnetCidrs,
+		"intra subnet":   opts.IntraSubnetCidrs,
+	} {
+		for _, cidr := range cidrs {
+			if err := validateCIDR(tier, cidr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	controlplaneRoleKey := opts.ControlplaneRoleAnnotationKey
+	if controlplaneRoleKey == "" {
+		controlplaneRoleKey = controlplaneRoleAnnotation
+	}
+	if errs := kvalidation.IsQualifiedName(controlplaneRoleKey); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid annotation key %q: %s", controlplaneRoleKey, strings.Join(errs, "; "))
+	}
+	if opts.IdentityNamespace != "" {
+		if opts.ClearIdentityRef {
+			return nil, errors.New("--identity-namespace and --clear-identity-ref are mutually exclusive")
+		}
+		if errs := kvalidation.IsDNS1123Label(opts.IdentityNamespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid identity namespace %q: %s", opts.IdentityNamespace, strings.Join(errs, "; "))
+		}
+	}
+
+	var eksVersion string
+	if opts.EKSVersion != "" {
+		if !eksVersionRegex.MatchString(opts.EKSVersion) {
+			return nil, fmt.Errorf("invalid eks version %q", opts.EKSVersion)
+		}
+		eksVersion = "v" + strings.TrimPrefix(opts.EKSVersion, "v")
+	}
+
+	if opts.VPCCNIVersion != "" && !vpcCNIVersionRegex.MatchString(opts.VPCCNIVersion) {
+		return nil, fmt.Errorf("invalid VPC CNI version %q, expected a version like v1.18.1-eksbuild.1", opts.VPCCNIVersion)
+	}
+	vpcCNIEnv, err := parseVPCCNIEnv(opts.VPCCNIEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := resolveTags(opts.TagProfile, opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newResourceFilter(opts.Selector, opts.Name)
+	if err != nil {
+		return nil, err
+	}
+	vpcTags, err := parseTags(opts.VPCTags)
+	if err != nil {
+		return nil, err
+	}
+	if vpcTags, err = resolveTags("", vpcTags); err != nil {
+		return nil, err
+	}
+	rootVol := rootVolume{size: opts.RootVolumeSize, volumeType: opts.RootVolumeType, iops: opts.RootVolumeIOPS}
+	if err := rootVol.validate(); err != nil {
+		return nil, err
+	}
+	var eksNames map[string]string
+	if opts.EKSClusterNameFromCluster {
+		if ioOpts.stream {
+			return nil, errors.New("--eks-cluster-name-from-cluster needs the whole input and can't be used with --stream")
+		}
+		if eksNames, err = eksClusterNames(in); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Replicas != nil && *opts.Replicas < 0 {
+		return nil, fmt.Errorf("invalid replicas %d, must not be negative", *opts.Replicas)
+	}
+	if opts.ManagedControlplaneRole != "" && opts.ManagedControlplaneRole == opts.ManagedMachinepoolRole {
+		w.add("control plane role %q and machine pool role %q are identical, the control plane role is likely passed to the machine pool by mistake", opts.ManagedControlplaneRole, opts.ManagedMachinepoolRole)
+	}
+
+	// The kinds left out by the filter are recorded, so that the roles are
+	// only required for the selected resources, and the matches are counted
+	// to report a --name that matches nothing.
+	excluded := make(map[string]bool)
+	var matched int
+	if filter != nil {
+		match := filter
+		filter = func(obj *unstructured.Unstructured) bool {
+			if match(obj) {
+				matched++
+				return true
+			}
+			excluded[obj.GetKind()] = true
+			return false
+		}
+	}
+	checkName := func() error {
+		switch {
+		case opts.Name == "" || matched > 0:
+			return nil
+		case opts.Selector != "":
+			return fmt.Errorf("no resource named %q matches the selector %q", opts.Name, opts.Selector)
+		}
+		return fmt.Errorf("no resource named %q found", opts.Name)
+	}
+
+	// configuration operation validation
+	isFound := make(map[string]bool)
+	hasSubnets := len(opts.SubnetCidrs) > 0 || len(opts.PublicSubnetCidrs) > 0 || len(opts.PrivateSubnetCidrs) > 0 || len(opts.IntraSubnetCidrs) > 0
+	helper := validationHelper{
+		isFound:                 isFound,
+		excluded:                excluded,
+		managedControlplaneRole: opts.ManagedControlplaneRole,
+		managedMachinepoolRole:  opts.ManagedMachinepoolRole,
+		vpcCidr:                 opts.VPCCidr,
+		podSecondaryCidr:        opts.PodSecondaryCidr,
+		lbScheme:                opts.LBScheme,
+		lbType:                  opts.LBType,
+		hasTags:                 len(tags) > 0,
+		hasVPCTags:              len(vpcTags) > 0,
+		hasRootVolume:           rootVol.isSet(),
+		architecture:            opts.Architecture,
+		eksVersion:              eksVersion,
+		hasVPCCNI:               opts.VPCCNIVersion != "" || len(vpcCNIEnv) > 0,
+		instanceType:            opts.InstanceType,
+		hasSubnets:              hasSubnets,
+		azUsageLimit:            opts.AZUsageLimit,
+		region:                  opts.Region,
+		natGatewayMode:          opts.NATGatewayMode,
+		vpcID:                   opts.VPCID,
+		internetGatewayID:       opts.InternetGatewayID,
+		minCount:                opts.MinNodeCount,
+		maxCount:                opts.MaxNodeCount,
+		desiredCount:            opts.DesiredNodeCount,
+	}
+	if err := validateFlags(helper); err != nil {
+		return nil, err
+	}
+	if err := coreOpts.validateFlags(); err != nil {
+		return nil, err
+	}
+	if ioOpts.validateFirst() {
+		kinds, err := ioOpts.kinds(in, filter)
+		if err != nil {
+			return nil, err
+		}
+		helper.isFound = kinds
+		if err := checkName(); err != nil {
+			return nil, err
+		}
+		if err := validation(helper); err != nil {
+			return nil, err
+		}
+		if err := coreOpts.validateKinds(kinds); err != nil {
+			return nil, err
+		}
+	}
+
+	var clearedIdentityRef, foundIdentityName bool
+	var mpInfraRefs []machinePoolInfraRef
+	var pools []nodePoolCapacity
+	managedMPNames := map[string]bool{}
+	fns := []parser.ResourceFn{coreOpts.apply, func(ri parser.ResourceInfo) error {
+		if opts.ClearIdentityRef && (ri.Object.GetKind() == awsManagedControlPlaneKind || ri.Object.GetKind() == awsClusterKind) {
+			if _, ok, _ := unstructured.NestedFieldNoCopy(ri.Object.UnstructuredContent(), "spec", "identityRef"); ok {
+				unstructured.RemoveNestedField(ri.Object.UnstructuredContent(), "spec", "identityRef")
+				clearedIdentityRef = true
+			}
+		}
+		if opts.IdentityNamespace != "" && (ri.Object.GetKind() == awsManagedControlPlaneKind || ri.Object.GetKind() == awsClusterKind) {
+			if name, _, _ := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "identityRef", "name"); name != "" {
+				foundIdentityName = true
+				if err := setField(ri, opts.IdentityNamespace, "spec", "identityRef", "namespace"); err != nil {
+					return err
+				}
+			}
+		}
+		if len(tags) > 0 {
+			if _, err := setAWSTags(ri, tags); err != nil {
+				return err
+			}
+		}
+		if rootVol.isSet() {
+			found, err := setAWSRootVolume(ri, rootVol)
+			if err != nil {
+				return err
+			}
+			if found {
+				isFound[ri.Object.GetKind()] = true
+			}
+		}
+		if ri.Object.GetKind() == awsManagedControlPlaneKind {
+			isFound[awsManagedControlPlaneKind] = true
+			if _, ok := awsManagedCPNetworkPaths[ri.Object.GetAPIVersion()]; !ok {
+				w.add("unrecognized %s apiVersion %q, using the field paths of %s", awsManagedControlPlaneKind, ri.Object.GetAPIVersion(), latestAWSManagedCPAPIVersion)
+			}
+			if opts.VPCCidr != "" {
+				err := setAWSManagedCPCIDR(&ri, opts.VPCCidr)
+				if err != nil {
+					return err
+				}
+			}
+			if opts.Region != "" {
+				if err := setField(ri, opts.Region, "spec", "region"); err != nil {
+					return err
+				}
+			}
+			if eksVersion != "" {
+				if err := setField(ri, eksVersion, "spec", "version"); err != nil {
+					return err
+				}
+			}
+			if opts.VPCCNIVersion != "" || len(vpcCNIEnv) > 0 {
+				if err := setAWSManagedCPVPCCNI(&ri, opts.VPCCNIVersion, vpcCNIEnv); err != nil {
+					return err
+				}
+			}
+			if opts.AZUsageLimit != 0 {
+				if err := setAWSManagedCPAZUsageLimit(&ri, opts.AZUsageLimit); err != nil {
+					return err
+				}
+			}
+			if opts.VPCID != "" {
+				if err := setAWSManagedCPVPC(&ri, opts.VPCID, opts.InternetGatewayID); err != nil {
+					return err
+				}
+			}
+			if len(vpcTags) > 0 {
+				if err := setAWSManagedCPVPCTags(&ri, vpcTags); err != nil {
+					return err
+				}
+			}
+			if opts.NATGatewayMode != "" {
+				if err := setAWSManagedCPNATGatewayMode(&ri, opts.NATGatewayMode); err != nil {
+					return err
+				}
+			}
+			if err := setAWSRoleName(&ri, opts.ManagedControlplaneRole); err != nil {
+				return err
+			}
+			if hasSubnets {
+				if err := setAWSManagedCPSubnets(&ri, opts.SubnetCidrs, opts.PublicSubnetCidrs, opts.PrivateSubnetCidrs, opts.IntraSubnetCidrs); err != nil {
+					return err
+				}
+			}
+			if opts.PodSecondaryCidr != "" && !skipped(ri.Object, skipNetwork) {
+				if err := setField(ri, opts.PodSecondaryCidr, "spec", "secondaryCidrBlock"); err != nil {
+					return err
+				}
+			}
+			if name, ok := eksNames[ri.Object.GetName()]; ok {
+				if err := setField(ri, name, "spec", "eksClusterName"); err != nil {
+					return err
+				}
+			} else if opts.ClusterName != "" {
+				if err := setField(ri, opts.ClusterName, "spec", "eksClusterName"); err != nil {
+					return err
+				}
+			}
+			addons := []interface{}{
+				map[string]any{
+					"name":               "aws-ebs-csi-driver",
+					"version":            opts.EBSCSIDriverVersion,
+					"conflictResolution": "overwrite",
+				},
+			}
+			if err := setField(ri, addons, "spec", "addons"); err != nil {
+				return err
+			}
+		}
+
+		if ri.Object.GetKind() == machinePoolKind {
+			isFound[machinePoolKind] = true
+			ref, _, _ := unstructured.NestedStringMap(ri.Object.UnstructuredContent(), "spec", "template", "spec", "infrastructureRef")
+			mpInfraRefs = append(mpInfraRefs, machinePoolInfraRef{pool: ri.Object.GetName(), kind: ref["kind"], name: ref["name"]})
+			err := SetMPConfiguration(ri, deafultMachinePoolName, opts.MinNodeCount, opts.MaxNodeCount, w)
+			if err != nil {
+				return err
+			}
+			if opts.Replicas != nil && !skipped(ri.Object, skipScaling) {
+				if err := setField(ri, *opts.Replicas, "spec", "replicas"); err != nil {
+					return err
+				}
+				warnReplicasOutsideBounds(ri, *opts.Replicas, w)
+			}
+		}
+
+		if ri.Object.GetKind() == awsManagedMachinePoolKind {
+			isFound[awsManagedMachinePoolKind] = true
+			if opts.Region != "" {
+				if err := checkAWSManagedMPRegion(&ri, opts.Region); err != nil {
+					return err
+				}
+			}
+			managedMPNames[ri.Object.GetName()] = true
+			err := setAWSManagedMPScaling(&ri, deafultMachinePoolName, opts.MinNodeCount, opts.MaxNodeCount, opts.DesiredNodeCount, w)
+			if err != nil {
+				return err
+			}
+			if err := setAWSRoleName(&ri, opts.ManagedMachinepoolRole); err != nil {
+				return err
+			}
+			if opts.InstanceType != "" {
+				if err := setField(ri, opts.InstanceType, "spec", "instanceType"); err != nil {
+					return err
+				}
+			} else if opts.NodeMachineType != "" {
+				if err := setField(ri, opts.NodeMachineType, "spec", "instanceType"); err != nil {
+					return err
+				}
+			}
+			if opts.Architecture != "" {
+				if err := setAWSManagedMPArchitecture(&ri, opts.Architecture, w); err != nil {
+					return err
+				}
+			}
+			if opts.CheckQuotas {
+				instanceType, _, _ := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "instanceType")
+				maxSize, _, _ := unstructured.NestedInt64(ri.Object.UnstructuredContent(), "spec", "scaling", "maxSize")
+				if instanceType == "" {
+					w.add("skipping quota check of %s %s, it has no instance type", awsManagedMachinePoolKind, resourceName(ri))
+				} else {
+					pools = append(pools, nodePoolCapacity{pool: resourceName(ri), instanceType: instanceType, maxSize: maxSize})
+				}
+			}
+		}
+
+		if ri.Object.GetKind() == awsClusterKind {
+			isFound[awsClusterKind] = true
+			if opts.LBScheme != "" {
+				if err := setField(ri, opts.LBScheme, "spec", "controlPlaneLoadBalancer", "scheme"); err != nil {
+					return err
+				}
+			}
+			if opts.LBType != "" {
+				if err := setField(ri, opts.LBType, "spec", "controlPlaneLoadBalancer", "loadBalancerType"); err != nil {
+					return err
+				}
+			}
+		}
+
+		if ri.Object.GetKind() == clusterKind {
+			isFound[clusterKind] = true
+			err := setAWSClusterAnnotations(&ri, controlplaneRoleKey, opts.ManagedControlplaneRole, opts.ManagedMachinepoolRole)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, coreOpts.pause, transformOpts.apply}
+	if filter != nil {
+		fns = []parser.ResourceFn{filterResources(filter, fns...)}
+	}
+	if opts.OnChange != nil {
+		fns = []parser.ResourceFn{trackChanges(opts.OnChange, fns...)}
+	}
+
+	out, err := ioOpts.processResources(in, fns...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := transformOpts.validate(); err != nil {
+		return nil, err
+	}
+	// Both MachinePool and AWSManagedMachinePool are renamed, so the
+	// reference is checked against the names of the input.
+	if len(managedMPNames) > 0 {
+		for _, ref := range mpInfraRefs {
+			if ref.kind != awsManagedMachinePoolKind || !managedMPNames[ref.name] {
+				return nil, fmt.Errorf("MachinePool %s references %s %q as infrastructure, which is not a configured AWSManagedMachinePool", ref.pool, ref.kind, ref.name)
+			}
+		}
+	}
+	if opts.ClearIdentityRef && opts.Strict && !clearedIdentityRef {
+		return nil, errors.New("failed to get spec.identityRef to clear")
+	}
+	if opts.IdentityNamespace != "" && !foundIdentityName {
+		w.add("no AWSManagedControlPlane or AWSCluster has a spec.identityRef with a name, the identity namespace is not set")
+	}
+	if !ioOpts.validateFirst() {
+		if err := checkName(); err != nil {
+			return nil, err
+		}
+		if err := validation(helper); err != nil {
+			return nil, err
+		}
+		if err := coreOpts.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.VerifyAWSRoles {
+		if err := verifyAWSRoles(context.Background(), w, opts.ManagedControlplaneRole, opts.ManagedMachinepoolRole); err != nil {
+			return nil, err
+		}
+	}
+	if opts.CheckQuotas {
+		if err := checkAWSQuotas(context.Background(), w, opts.Region, pools); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.flush(opts.Quiet, opts.Strict); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 func NewCmdCAPA() *cobra.Command {
-	var minNodeCount, maxNodeCount int64
-	isFound := make(map[string]bool)
+	var opts CAPAOptions
+	var replicas int64
+	var setTags []string
+	var dryRun, explain bool
+	var cidrPool cidrPoolOptions
+	var coreOpts coreOptions
+	var transformOpts transformOptions
+	var ioOpts ioOptions
 	cmd := &cobra.Command{
 		Use:               "capa",
 		Short:             "Configure CAPA network config",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			in, err := io.ReadAll(os.Stdin)
-			if err != nil {
-				return err
+			if explain {
+				return explainValidation(os.Stdout)
 			}
-			vpcCidr := os.Getenv("VPC_CIDR")
-			clusterName := os.Getenv("CLUSTER_NAME")
-			managedControlplaneRole := os.Getenv("CONTROLPLANE_ROLE")
-			ebsCSIDriverVersion := os.Getenv("EBS_CSI_DRIVER_VERSION")
-			managedMachinepoolRole := fmt.Sprintf("nodes%s-%s-%s", clusterName, os.Getenv("CLUSTER_NAMESPACE"), os.Getenv("SUFFIX"))
-			nodeMachineType := os.Getenv("AWS_NODE_MACHINE_TYPE")
-
-			var out bytes.Buffer
-			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
-				if ri.Object.GetKind() == awsManagedControlPlaneKind {
-					isFound[awsManagedControlPlaneKind] = true
-					if vpcCidr != "" {
-						err := setAWSManagedCPCIDR(&ri, vpcCidr)
-						if err != nil {
-							return err
-						}
-					}
-					if managedControlplaneRole != "" {
-						if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), managedControlplaneRole, "spec", "roleName"); err != nil {
-							return err
-						}
-					}
-					if clusterName != "" {
-						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), clusterName, "spec", "eksClusterName"); err != nil {
-							return err
-						}
-					}
-					addons := []interface{}{
-						map[string]any{
-							"name":               "aws-ebs-csi-driver",
-							"version":            ebsCSIDriverVersion,
-							"conflictResolution": "overwrite",
-						},
-					}
-					if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), addons, "spec", "addons"); err != nil {
-						return err
-					}
+			return ioOpts.run(func() error {
+				if err := ioOpts.printEffectiveConfig(cmd.LocalFlags(), "VPC_CIDR", "CLUSTER_NAME", "CLUSTER_NAMESPACE", "SUFFIX", "CONTROLPLANE_ROLE", "EBS_CSI_DRIVER_VERSION", "AWS_NODE_MACHINE_TYPE"); err != nil {
+					return err
+				}
+				in, err := ioOpts.readInput()
+				if err != nil {
+					return err
 				}
 
-				if ri.Object.GetKind() == machinePoolKind {
-					isFound[machinePoolKind] = true
-					err := SetMPConfiguration(ri, deafultMachinePoolName, minNodeCount, maxNodeCount)
+				opts.VPCCidr = os.Getenv("VPC_CIDR")
+				opts.ClusterName = os.Getenv("CLUSTER_NAME")
+				opts.ManagedControlplaneRole = os.Getenv("CONTROLPLANE_ROLE")
+				opts.EBSCSIDriverVersion = os.Getenv("EBS_CSI_DRIVER_VERSION")
+				opts.ManagedMachinepoolRole = fmt.Sprintf("nodes%s-%s-%s", opts.ClusterName, os.Getenv("CLUSTER_NAMESPACE"), os.Getenv("SUFFIX"))
+				opts.NodeMachineType = os.Getenv("AWS_NODE_MACHINE_TYPE")
+
+				if cidrPool.enabled() {
+					if opts.VPCCidr != "" {
+						return errors.New("VPC_CIDR and --cidr-pool are mutually exclusive")
+					}
+					key := opts.ClusterName
+					if ns := os.Getenv("CLUSTER_NAMESPACE"); ns != "" {
+						key = ns + "/" + opts.ClusterName
+					}
+					opts.VPCCidr, err = cidrPool.allocate(key)
 					if err != nil {
 						return err
 					}
 				}
 
-				if ri.Object.GetKind() == awsManagedMachinePoolKind {
-					isFound[awsManagedMachinePoolKind] = true
-					err := setAWSManagedMPScaling(&ri, deafultMachinePoolName, minNodeCount, maxNodeCount)
+				opts.Replicas = nil
+				if cmd.Flags().Changed("replicas") {
+					opts.Replicas = &replicas
+				}
+				transformOpts.keepFlagDefaults(cmd.Flags())
+				if len(setTags) > 0 {
+					tags, err := parseTags(setTags)
 					if err != nil {
 						return err
 					}
-					if managedMachinepoolRole != "" {
-						if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), managedMachinepoolRole, "spec", "roleName"); err != nil {
-							return err
-						}
-					}
-					if nodeMachineType != "" {
-						if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), nodeMachineType, "spec", "instanceType"); err != nil {
-							return err
+					for k, v := range opts.Tags {
+						if _, ok := tags[k]; !ok {
+							tags[k] = v
 						}
 					}
+					opts.Tags = tags
 				}
 
-				if ri.Object.GetKind() == clusterKind {
-					isFound[clusterKind] = true
-					err := setAWSClusterAnnotations(&ri, managedControlplaneRole, managedMachinepoolRole)
-					if err != nil {
-						return err
+				opts.OnChange = nil
+				if dryRun {
+					if ioOpts.stream {
+						return errors.New("--dry-run and --stream are mutually exclusive")
 					}
+					opts.OnChange = printChange(os.Stderr)
 				}
-
-				data, err := yaml.Marshal(ri.Object)
-				if err != nil {
+				opts.Quiet = ioOpts.quiet
+				opts.Strict = ioOpts.strict
+				opts.coreOpts = &coreOpts
+				opts.transformOpts = &transformOpts
+				opts.ioOpts = &ioOpts
+				out, err := ConfigureCAPA(in, opts)
+				if err != nil || dryRun {
 					return err
 				}
-				if out.Len() > 0 {
-					out.WriteString("---\n")
-				}
-				_, err = out.Write(data)
-				return err
-			})
-			if err != nil {
-				return err
-			}
-
-			// configuration operation validation
-			err = validation(validationHelper{
-				isFound:                 isFound,
-				managedControlplaneRole: managedControlplaneRole,
-				managedMachinepoolRole:  managedMachinepoolRole,
-				vpcCidr:                 vpcCidr,
-				minCount:                minNodeCount,
-				maxCount:                maxNodeCount,
+				return ioOpts.write(out)
 			})
-			if err != nil {
-				return err
-			}
-
-			_, err = os.Stdout.Write(out.Bytes())
-			return err
 		},
 	}
-	cmd.Flags().Int64Var(&minNodeCount, "min-node-count", 2, "Minimum count of nodes in nodepool")
-	cmd.Flags().Int64Var(&maxNodeCount, "max-node-count", 6, "Maximum count of nodes in nodepool")
+	cmd.Flags().Int64Var(&opts.MinNodeCount, "min-node-count", 2, "Minimum count of nodes in nodepool")
+	cmd.Flags().Int64Var(&opts.MaxNodeCount, "max-node-count", 6, "Maximum count of nodes in nodepool")
+	cmd.Flags().Int64Var(&opts.DesiredNodeCount, "desired-node-count", 0, "Desired count of nodes in nodepool (unset when 0)")
+	cmd.Flags().Int64Var(&replicas, "replicas", 0, "Replica count of the MachinePool (unset when not given)")
+	cmd.Flags().StringVar(&opts.PodSecondaryCidr, "pod-secondary-cidr", "", "Secondary CIDR block of the VPC used for pods")
+	cmd.Flags().Int64Var(&opts.AZUsageLimit, "az-usage-limit", 0, "Maximum number of availability zones used by the subnets of the VPC, 1 to 6 (unset when 0)")
+	cmd.Flags().StringArrayVar(&opts.SubnetCidrs, "subnet-cidr", nil, "CIDR block of a subnet without a tier (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.PublicSubnetCidrs, "public-subnet-cidr", nil, "CIDR block of a public subnet (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.PrivateSubnetCidrs, "private-subnet-cidr", nil, "CIDR block of a private subnet (repeatable)")
+	cmd.Flags().StringArrayVar(&opts.IntraSubnetCidrs, "intra-subnet-cidr", nil, "CIDR block of an intra subnet without internet routing (repeatable)")
+	cmd.Flags().StringVar(&opts.ControlplaneRoleAnnotationKey, "controlplane-role-annotation-key", controlplaneRoleAnnotation, "Cluster annotation key the control plane role is written to")
+	cmd.Flags().BoolVar(&opts.EKSClusterNameFromCluster, "eks-cluster-name-from-cluster", false, "Set spec.eksClusterName of AWSManagedControlPlane to the name of its Cluster instead of CLUSTER_NAME")
+	cmd.Flags().StringVar(&opts.Architecture, "architecture", "", "CPU architecture of the AWSManagedMachinePool nodes, amd64 or arm64, selecting the AMI type within its AMI family")
+	cmd.Flags().Int64Var(&opts.RootVolumeSize, "root-volume-size", 0, "Root volume size in GiB of AWSMachineTemplate and AWSMachinePool instances (unset when 0)")
+	cmd.Flags().StringVar(&opts.RootVolumeType, "root-volume-type", "", "EBS type of the root volume of AWSMachineTemplate and AWSMachinePool instances, like gp3 or io2")
+	cmd.Flags().Int64Var(&opts.RootVolumeIOPS, "root-volume-iops", 0, "Provisioned IOPS of the root volume, for the gp3, io1 and io2 types (unset when 0)")
+	cmd.Flags().StringVar(&opts.InstanceType, "instance-type", "", "Instance type of the AWSManagedMachinePool, overriding AWS_NODE_MACHINE_TYPE")
+	cmd.Flags().StringArrayVar(&opts.VPCTags, "vpc-tag", nil, "Tag in key=value format merged into the tags of the VPC of the AWSManagedControlPlane (repeatable)")
+	cmd.Flags().StringVar(&opts.VPCCNIVersion, "vpc-cni-version", "", "Version of the VPC CNI addon of the AWSManagedControlPlane, like v1.18.1-eksbuild.1")
+	cmd.Flags().StringArrayVar(&opts.VPCCNIEnv, "vpc-cni-env", nil, "Env var of the VPC CNI in NAME=value format, merged with the existing env vars of the AWSManagedControlPlane (repeatable)")
+	cmd.Flags().StringVar(&opts.EKSVersion, "eks-version", "", "Kubernetes version of the AWSManagedControlPlane, like v1.29 or 1.29")
+	cmd.Flags().StringVar(&opts.Region, "region", "", "AWS region of the AWSManagedControlPlane, machine pools in other regions are rejected")
+	cmd.Flags().StringVar(&opts.VPCID, "vpc-id", "", "ID of an existing VPC used by the AWSManagedControlPlane")
+	cmd.Flags().StringVar(&opts.InternetGatewayID, "internet-gateway-id", "", "ID of the internet gateway of the existing VPC, requires --vpc-id")
+	cmd.Flags().StringVar(&opts.NATGatewayMode, "nat-gateway-mode", "", "NAT gateways of the VPC, single for one shared gateway or per-az for one gateway per availability zone")
+	cmd.Flags().StringVar(&opts.LBScheme, "lb-scheme", "", "Scheme of the AWSCluster control plane load balancer, internet-facing or internal")
+	cmd.Flags().StringVar(&opts.LBType, "lb-type", "", "Type of the AWSCluster control plane load balancer, one of classic, elb, alb, nlb or disabled")
+	cmd.Flags().StringToStringVar(&opts.Tags, "tag", nil, "Tags merged into the additional tags of the AWS resources, overriding the tags of --tag-profile (repeatable, the last value of a repeated key wins)")
+	cmd.Flags().StringVar(&opts.Name, "name", "", "Name of the resources to mutate, the others are passed through unchanged")
+	cmd.Flags().StringVar(&opts.Selector, "selector", "", "Label selector like key=value,key2=value2, only matching resources are mutated and the others passed through unchanged")
+	cmd.Flags().BoolVar(&explain, "explain-validation", false, "Print the rules the flags are validated against and exit")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changed fields of every resource to stderr instead of writing the result")
+	cmd.Flags().StringArrayVar(&setTags, "set-tags", nil, "Tag in key=value format merged into the additional tags of the AWS resources, overriding --tag (repeatable, the last value of a repeated key wins)")
+	cmd.Flags().StringVar(&opts.TagProfile, "tag-profile", "", "Predefined set of environment tags merged into the additional tags of the AWS resources, one of dev, staging or prod")
+	cmd.Flags().StringVar(&opts.IdentityNamespace, "identity-namespace", "", "Namespace set on spec.identityRef of AWSManagedControlPlane and AWSCluster, where the identity name is set")
+	cmd.Flags().BoolVar(&opts.ClearIdentityRef, "clear-identity-ref", false, "Remove spec.identityRef from AWSManagedControlPlane and AWSCluster")
+	cmd.Flags().BoolVar(&opts.CheckQuotas, "check-quotas", false, "Check with the AWS Service Quotas API that the machine pools at their max node count fit within the vCPU quota of their instance family, skipped when no AWS credentials are available")
+	cmd.Flags().BoolVar(&opts.VerifyAWSRoles, "verify-aws-roles", false, "Check with the AWS IAM API that the control plane and machine pool roles exist, skipped when no AWS credentials are available")
+	cidrPool.AddFlags(cmd.Flags())
+	coreOpts.AddFlags(cmd.Flags())
+	transformOpts.AddFlags(cmd.Flags())
+	ioOpts.AddFlags(cmd.Flags())
 	return cmd
 }
@@ -0,0 +1,517 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSetAWSManagedCPCIDRAPIVersions(t *testing.T) {
+	tests := []struct {
+		apiVersion string
+		path       []string
+	}{
+		{apiVersion: "controlplane.cluster.x-k8s.io/v1alpha3", path: []string{"spec", "networkSpec", "vpc", "cidrBlock"}},
+		{apiVersion: "controlplane.cluster.x-k8s.io/v1beta2", path: []string{"spec", "network", "vpc", "cidrBlock"}},
+		{apiVersion: "controlplane.cluster.x-k8s.io/v9", path: []string{"spec", "network", "vpc", "cidrBlock"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.apiVersion, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion(tt.apiVersion)
+			obj.SetKind(awsManagedControlPlaneKind)
+			obj.SetName("capi-control-plane")
+			ri := parser.ResourceInfo{Object: obj}
+
+			if err := setAWSManagedCPCIDR(&ri, "10.0.0.0/16"); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := unstructured.NestedString(obj.Object, tt.path...)
+			if err != nil || !ok || got != "10.0.0.0/16" {
+				t.Errorf("%v = %q, %v, %v; want %q", tt.path, got, ok, err, "10.0.0.0/16")
+			}
+			spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+			if len(spec) != 1 {
+				t.Errorf("spec = %v, want only %q", spec, tt.path[1])
+			}
+		})
+	}
+
+	ri := parser.ResourceInfo{Object: &unstructured.Unstructured{}}
+	ri.Object.SetAPIVersion("controlplane.cluster.x-k8s.io/v1alpha3")
+	if got, want := awsManagedCPNetworkPath(&ri, "subnets"), []string{"spec", "networkSpec", "subnets"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("awsManagedCPNetworkPath() = %v, want %v", got, want)
+	}
+}
+
+// readFixtureDocuments returns the YAML documents of a fixture by kind.
+func readFixtureDocuments(t *testing.T, fixture string) map[string]string {
+	t.Helper()
+	in, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := make(map[string]string)
+	for _, doc := range strings.Split(string(in), "---\n") {
+		var obj unstructured.Unstructured
+		if err := yaml.Unmarshal([]byte(doc), &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		docs[obj.GetKind()] = doc
+	}
+	return docs
+}
+
+// joinDocuments returns the manifest of the documents of kinds, in order.
+func joinDocuments(docs map[string]string, kinds ...string) []byte {
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, docs[kind])
+	}
+	return []byte(strings.Join(parts, "---\n"))
+}
+
+// configureCAPA runs ConfigureCAPA on in and returns the resulting resources
+// by kind. The fixtures have a single resource of every kind.
+func configureCAPA(t *testing.T, in []byte, opts CAPAOptions) (map[string]*unstructured.Unstructured, error) {
+	t.Helper()
+	opts.Quiet = true
+	out, err := ConfigureCAPA(in, opts)
+	if err != nil {
+		return nil, err
+	}
+	objs := make(map[string]*unstructured.Unstructured)
+	err = parser.ProcessResources(out, func(ri parser.ResourceInfo) error {
+		objs[ri.Object.GetKind()] = ri.Object
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objs, nil
+}
+
+func nestedString(t *testing.T, objs map[string]*unstructured.Unstructured, kind string, path ...string) string {
+	t.Helper()
+	obj, ok := objs[kind]
+	if !ok {
+		t.Fatalf("%s is missing from the output", kind)
+	}
+	s, _, err := unstructured.NestedString(obj.Object, path...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestConfigureCAPAFilter checks that --name and --selector limit the
+// mutations, and that the roles, which are always set from the environment,
+// don't require the kinds left out by the filter.
+func TestConfigureCAPAFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     CAPAOptions
+		wantErr  bool
+		cpRegion string
+		mpRole   string
+	}{
+		{
+			name:     "name selects the control plane",
+			opts:     CAPAOptions{Name: "c1-control-plane", Region: "eu-west-1"},
+			cpRegion: "eu-west-1",
+		},
+		{
+			name:     "selector selects the control plane",
+			opts:     CAPAOptions{Selector: "tier=control-plane", Region: "eu-west-1"},
+			cpRegion: "eu-west-1",
+		},
+		{
+			name:     "name selects the machine pools",
+			opts:     CAPAOptions{Name: "c1-pool-0"},
+			cpRegion: "us-east-1",
+			mpRole:   "nodes-role",
+		},
+		{
+			name:    "selector matches nothing",
+			opts:    CAPAOptions{Selector: "tier=none", InstanceType: "m5.large"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.ManagedControlplaneRole = "cp-role"
+			tt.opts.ManagedMachinepoolRole = "nodes-role"
+			in, err := os.ReadFile(filepath.Join("testdata", "eks.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			objs, err := configureCAPA(t, in, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigureCAPA() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := nestedString(t, objs, awsManagedControlPlaneKind, "spec", "region"); got != tt.cpRegion {
+				t.Errorf("control plane region = %q, want %q", got, tt.cpRegion)
+			}
+			if got := nestedString(t, objs, awsManagedMachinePoolKind, "spec", "roleName"); got != tt.mpRole {
+				t.Errorf("machine pool role = %q, want %q", got, tt.mpRole)
+			}
+		})
+	}
+}
+
+// TestConfigureCAPAUnmatchedName checks that a --name matching no resource
+// fails with the name, with and without fail-fast.
+func TestConfigureCAPAUnmatchedName(t *testing.T) {
+	in, err := os.ReadFile(filepath.Join("testdata", "eks.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		opts    CAPAOptions
+		wantErr string
+	}{
+		{
+			name:    "unknown name",
+			opts:    CAPAOptions{Name: "c2-control-plane"},
+			wantErr: `no resource named "c2-control-plane" found`,
+		},
+		{
+			name:    "name left out by the selector",
+			opts:    CAPAOptions{Name: "c1-control-plane", Selector: "tier=none"},
+			wantErr: `no resource named "c1-control-plane" matches the selector "tier=none"`,
+		},
+		{
+			name: "matched name",
+			opts: CAPAOptions{Name: "c1-control-plane"},
+		},
+	}
+	for _, tt := range tests {
+		for _, failFast := range []bool{true, false} {
+			opts := tt.opts
+			opts.MinNodeCount, opts.MaxNodeCount = 1, 3
+			opts.ioOpts = &ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing, failFast: failFast}
+			_, err := configureCAPA(t, in, opts)
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("%s, fail-fast %v: ConfigureCAPA() error = %q, want %q", tt.name, failFast, got, tt.wantErr)
+			}
+		}
+	}
+}
+
+// TestConfigureCAPADocumentOrder checks that the output and the validation
+// don't depend on the order of the documents, with and without fail-fast.
+func TestConfigureCAPADocumentOrder(t *testing.T) {
+	docs := readFixtureDocuments(t, "eks.yaml")
+	orders := map[string][]string{
+		"cluster first":      {clusterKind, awsManagedControlPlaneKind, machinePoolKind, awsManagedMachinePoolKind},
+		"pools first":        {machinePoolKind, awsManagedMachinePoolKind, clusterKind, awsManagedControlPlaneKind},
+		"control plane last": {clusterKind, machinePoolKind, awsManagedMachinePoolKind, awsManagedControlPlaneKind},
+		"reversed":           {awsManagedMachinePoolKind, machinePoolKind, awsManagedControlPlaneKind, clusterKind},
+	}
+	opts := CAPAOptions{
+		VPCCidr:                 "10.0.0.0/16",
+		ClusterName:             "c1",
+		ManagedControlplaneRole: "cp-role",
+		ManagedMachinepoolRole:  "nodes-role",
+		MinNodeCount:            1,
+		MaxNodeCount:            5,
+	}
+	fields := []struct {
+		kind string
+		path []string
+		want string
+	}{
+		{kind: awsManagedControlPlaneKind, path: []string{"spec", "network", "vpc", "cidrBlock"}, want: "10.0.0.0/16"},
+		{kind: awsManagedControlPlaneKind, path: []string{"spec", "roleName"}, want: "cp-role"},
+		{kind: awsManagedControlPlaneKind, path: []string{"spec", "eksClusterName"}, want: "c1"},
+		{kind: awsManagedMachinePoolKind, path: []string{"spec", "roleName"}, want: "nodes-role"},
+		{kind: awsManagedMachinePoolKind, path: []string{"metadata", "name"}, want: deafultMachinePoolName},
+		{kind: machinePoolKind, path: []string{"metadata", "annotations", autoscalerMaxSizeAnnotation}, want: "5"},
+		{kind: machinePoolKind, path: []string{"spec", "template", "spec", "infrastructureRef", "name"}, want: deafultMachinePoolName},
+		{kind: clusterKind, path: []string{"metadata", "annotations", controlplaneRoleAnnotation}, want: "cp-role"},
+		{kind: clusterKind, path: []string{"metadata", "annotations", machinepoolRoleAnnotation}, want: "nodes-role"},
+	}
+
+	for _, failFast := range []bool{true, false} {
+		var want map[string]*unstructured.Unstructured
+		for name, kinds := range orders {
+			opts := opts
+			opts.ioOpts = &ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing, failFast: failFast}
+			objs, err := configureCAPA(t, joinDocuments(docs, kinds...), opts)
+			if err != nil {
+				t.Fatalf("%s, fail-fast %v: ConfigureCAPA() error = %v", name, failFast, err)
+			}
+			for _, f := range fields {
+				if got := nestedString(t, objs, f.kind, f.path...); got != f.want {
+					t.Errorf("%s, fail-fast %v: %s %s = %q, want %q", name, failFast, f.kind, strings.Join(f.path, "."), got, f.want)
+				}
+			}
+			if want == nil {
+				want = objs
+			} else if !reflect.DeepEqual(objs, want) {
+				t.Errorf("%s, fail-fast %v: output differs from the other document orders", name, failFast)
+			}
+		}
+	}
+}
+
+// TestConfigureCAPAValidation checks that the validation errors are the
+// same for every document order, with and without fail-fast.
+func TestConfigureCAPAValidation(t *testing.T) {
+	docs := readFixtureDocuments(t, "eks.yaml")
+	tests := []struct {
+		name    string
+		kinds   []string
+		opts    CAPAOptions
+		wantErr string
+	}{
+		{
+			name:    "VPC CIDR without control plane",
+			kinds:   []string{clusterKind, machinePoolKind, awsManagedMachinePoolKind},
+			opts:    CAPAOptions{VPCCidr: "10.0.0.0/16"},
+			wantErr: "failed to get AWSManagedControlPlane for cidr update",
+		},
+		{
+			name:    "machine pool role without machine pool",
+			kinds:   []string{awsManagedControlPlaneKind, clusterKind},
+			opts:    CAPAOptions{ManagedMachinepoolRole: "nodes-role"},
+			wantErr: "failed to get AWSManagedMachinePool for role configuration",
+		},
+		{
+			name:    "roles without cluster",
+			kinds:   []string{awsManagedMachinePoolKind, awsManagedControlPlaneKind, machinePoolKind},
+			opts:    CAPAOptions{ManagedControlplaneRole: "cp-role", ManagedMachinepoolRole: "nodes-role"},
+			wantErr: "failed to get Cluster Kind to update annotations",
+		},
+		{
+			name:  "complete manifest",
+			kinds: []string{awsManagedMachinePoolKind, machinePoolKind, awsManagedControlPlaneKind, clusterKind},
+			opts:  CAPAOptions{VPCCidr: "10.0.0.0/16", ManagedControlplaneRole: "cp-role", ManagedMachinepoolRole: "nodes-role"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reversed := slices.Clone(tt.kinds)
+			slices.Reverse(reversed)
+			for _, kinds := range [][]string{tt.kinds, reversed} {
+				for _, failFast := range []bool{true, false} {
+					opts := tt.opts
+					opts.MinNodeCount, opts.MaxNodeCount = 1, 3
+					opts.ioOpts = &ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing, failFast: failFast}
+					_, err := configureCAPA(t, joinDocuments(docs, kinds...), opts)
+					var got string
+					if err != nil {
+						got = err.Error()
+					}
+					if got != tt.wantErr {
+						t.Errorf("order %v, fail-fast %v: ConfigureCAPA() error = %q, want %q", kinds, failFast, got, tt.wantErr)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestConfigureCAPAFlagRules checks that the rules on the flags alone fail
+// before any resource is processed, so that --stream writes nothing.
+func TestConfigureCAPAFlagRules(t *testing.T) {
+	in, err := os.ReadFile(filepath.Join("testdata", "eks.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		opts    CAPAOptions
+		wantErr string
+	}{
+		{
+			name:    "min node count above max",
+			opts:    CAPAOptions{MinNodeCount: 5, MaxNodeCount: 2},
+			wantErr: "max node count can't be less than min node count",
+		},
+		{
+			name:    "region",
+			opts:    CAPAOptions{Region: "mars-1"},
+			wantErr: `invalid region "mars-1"`,
+		},
+		{
+			name:    "NAT gateway mode",
+			opts:    CAPAOptions{NATGatewayMode: "none"},
+			wantErr: `invalid NAT gateway mode "none", expected single or per-az`,
+		},
+		{
+			name:    "availability zone usage limit",
+			opts:    CAPAOptions{AZUsageLimit: 7},
+			wantErr: "invalid availability zone usage limit 7, expected 1 to 6",
+		},
+		{
+			name:    "load balancer scheme",
+			opts:    CAPAOptions{LBScheme: "public"},
+			wantErr: `invalid load balancer scheme "public", expected internet-facing or internal`,
+		},
+	}
+	for _, tt := range tests {
+		for _, failFast := range []bool{true, false} {
+			var out bytes.Buffer
+			opts := tt.opts
+			if opts.MaxNodeCount == 0 {
+				opts.MinNodeCount, opts.MaxNodeCount = 1, 3
+			}
+			opts.Quiet = true
+			opts.ioOpts = &ioOptions{
+				outputFormat: outputFormatYAML,
+				fieldMode:    fieldModeCreateIfMissing,
+				failFast:     failFast,
+				stream:       true,
+				stdin:        bytes.NewReader(in),
+				stdout:       &out,
+			}
+			_, err := ConfigureCAPA(nil, opts)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s, fail-fast %v: ConfigureCAPA() error = %v, want %q", tt.name, failFast, err, tt.wantErr)
+			}
+			if out.Len() > 0 {
+				t.Errorf("%s, fail-fast %v: --stream wrote %q before failing", tt.name, failFast, out.String())
+			}
+		}
+	}
+}
+
+func newResourceInfo(apiVersion, kind string, spec any) parser.ResourceInfo {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]any{"name": "c1"},
+	}}
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+	return parser.ResourceInfo{Object: obj}
+}
+
+func TestSetAWSRoleName(t *testing.T) {
+	tests := []struct {
+		name    string
+		ri      parser.ResourceInfo
+		role    string
+		want    string
+		wantErr bool
+	}{
+		{name: "control plane", ri: newResourceInfo("controlplane.cluster.x-k8s.io/v1beta2", awsManagedControlPlaneKind, nil), role: "cp-role", want: "cp-role"},
+		{name: "machine pool", ri: newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", awsManagedMachinePoolKind, map[string]any{"roleName": "old"}), role: "nodes-role", want: "nodes-role"},
+		{name: "empty role", ri: newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", awsManagedMachinePoolKind, map[string]any{"roleName": "old"}), want: "old"},
+		{name: "scalar spec", ri: newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", awsManagedMachinePoolKind, "invalid"), role: "nodes-role", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setAWSRoleName(&tt.ri, tt.role)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setAWSRoleName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got, _, _ := unstructured.NestedString(tt.ri.Object.Object, "spec", "roleName"); got != tt.want {
+				t.Errorf("spec.roleName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAWSClusterAnnotations(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		cpRole   string
+		mpRole   string
+		wantKeys map[string]string
+	}{
+		{
+			name:     "both roles",
+			key:      controlplaneRoleAnnotation,
+			cpRole:   "cp-role",
+			mpRole:   "nodes-role",
+			wantKeys: map[string]string{controlplaneRoleAnnotation: "cp-role", machinepoolRoleAnnotation: "nodes-role"},
+		},
+		{
+			name:     "custom control plane key",
+			key:      "example.com/cp-role",
+			cpRole:   "cp-role",
+			wantKeys: map[string]string{"example.com/cp-role": "cp-role"},
+		},
+		{
+			name:     "no roles",
+			key:      controlplaneRoleAnnotation,
+			wantKeys: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ri := newResourceInfo("cluster.x-k8s.io/v1beta1", clusterKind, nil)
+			if err := setAWSClusterAnnotations(&ri, tt.key, tt.cpRole, tt.mpRole); err != nil {
+				t.Fatal(err)
+			}
+			if got := ri.Object.GetAnnotations(); !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("annotations = %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+// TestAWSManagedCPNetworkConflicts checks that failures to set the network
+// fields are returned to the caller.
+func TestAWSManagedCPNetworkConflicts(t *testing.T) {
+	const apiVersion = "controlplane.cluster.x-k8s.io/v1beta2"
+
+	ri := newResourceInfo(apiVersion, awsManagedControlPlaneKind, "invalid")
+	if err := setAWSManagedCPCIDR(&ri, "10.0.0.0/16"); err == nil {
+		t.Error("setAWSManagedCPCIDR() with a scalar spec returned no error")
+	}
+
+	ri = newResourceInfo(apiVersion, awsManagedControlPlaneKind, map[string]any{"network": "flat"})
+	if err := setAWSManagedCPAZUsageLimit(&ri, 2); err == nil {
+		t.Error("setAWSManagedCPAZUsageLimit() with a scalar spec.network returned no error")
+	}
+
+	// spec.network is the field set by setAWSManagedCPCIDR, so a scalar
+	// there is replaced rather than reported.
+	ri = newResourceInfo(apiVersion, awsManagedControlPlaneKind, map[string]any{"network": "flat"})
+	if err := setAWSManagedCPCIDR(&ri, "10.0.0.0/16"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := unstructured.NestedString(ri.Object.Object, "spec", "network", "vpc", "cidrBlock"); got != "10.0.0.0/16" {
+		t.Errorf("spec.network.vpc.cidrBlock = %q, want %q", got, "10.0.0.0/16")
+	}
+}
@@ -17,137 +17,241 @@ limitations under the License.
 package config
 
 import (
-	"bytes"
 	"errors"
-	"io"
+	"fmt"
 	"os"
+	"regexp"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"kmodules.xyz/client-go/tools/parser"
-	"sigs.k8s.io/yaml"
 )
 
+const gcpManagedControlPlaneKind = "GCPManagedControlPlane"
+
+var (
+	gcpProjectRegex  = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+	gcpLocationRegex = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+(-[a-z])?$`)
+)
+
+// validateCAPGFlags validates the format of the project and region flags.
+func validateCAPGFlags(project, region string) error {
+	if project != "" && !gcpProjectRegex.MatchString(project) {
+		return fmt.Errorf("invalid project id %q", project)
+	}
+	if region != "" && !gcpLocationRegex.MatchString(region) {
+		return fmt.Errorf("invalid region %q", region)
+	}
+	return nil
+}
+
+// validateCAPG validates the project and region flags against the kinds
+// found in the input.
+func validateCAPG(isFound map[string]bool, project, region string) error {
+	if project != "" && !isFound[gcpManagedControlPlaneKind] {
+		return fmt.Errorf("failed to get %s for project configuration", gcpManagedControlPlaneKind)
+	}
+	if region != "" && !isFound[gcpManagedControlPlaneKind] {
+		return fmt.Errorf("failed to get %s for region configuration", gcpManagedControlPlaneKind)
+	}
+	return nil
+}
+
 func NewCmdCAPG() *cobra.Command {
 	var minSize int64
 	var maxSize int64
+	var project string
+	var region string
+	var coreOpts coreOptions
+	var transformOpts transformOptions
+	var ioOpts ioOptions
 
 	cmd := &cobra.Command{
 		Use:               "capg",
 		Short:             "Configure CAPG config",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			in, err := io.ReadAll(os.Stdin)
-			if err != nil {
-				return err
-			}
-			subnetCidr := os.Getenv("SUBNET_CIDR")
-			if subnetCidr == "" {
-				_, err = os.Stdout.Write(in)
-				return err
-			}
-			clusterName := os.Getenv("CLUSTER_NAME")
-			kubernetesVersion := os.Getenv("KUBERNETES_VERSION")
-			nodeMachineType := os.Getenv("GCP_NODE_MACHINE_TYPE")
-
-			var out bytes.Buffer
-			var foundCP bool
-			var foundMP bool
-			var foundManagedMP bool
-			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
-				if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "GCPManagedCluster" {
-					foundCP = true
-
-					if err = SetGCPNetworkConfiguration(ri, subnetCidr); err != nil {
-						return err
+			return ioOpts.run(func() error {
+				coreOpts.reset()
+				transformOpts.reset()
+				if err := ioOpts.printEffectiveConfig(cmd.LocalFlags(), "SUBNET_CIDR", "CLUSTER_NAME", "KUBERNETES_VERSION", "GCP_NODE_MACHINE_TYPE"); err != nil {
+					return err
+				}
+				in, err := ioOpts.readInput()
+				if err != nil {
+					return err
+				}
+				subnetCidr := os.Getenv("SUBNET_CIDR")
+				if subnetCidr == "" && project == "" && region == "" {
+					if ioOpts.stream || ioOpts.provider != "" {
+						out, err := ioOpts.processResources(in)
+						if err != nil || ioOpts.stream {
+							return err
+						}
+						return ioOpts.write(out)
 					}
+					return ioOpts.write(in)
+				}
+				clusterName := os.Getenv("CLUSTER_NAME")
+				kubernetesVersion := os.Getenv("KUBERNETES_VERSION")
+				nodeMachineType := os.Getenv("GCP_NODE_MACHINE_TYPE")
 
-				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "GCPManagedMachinePool" {
-					foundManagedMP = true
-
-					if err = SetGCPManagedMPConfiguration(ri, deafultMachinePoolName, minSize, maxSize); err != nil {
+				var foundCP bool
+				var foundMP bool
+				var foundManagedMP bool
+				isFound := make(map[string]bool)
+				if err := validateCAPGFlags(project, region); err != nil {
+					return err
+				}
+				if err := coreOpts.validateFlags(); err != nil {
+					return err
+				}
+				if ioOpts.validateFirst() {
+					kinds, err := ioOpts.kinds(in, nil)
+					if err != nil {
 						return err
 					}
-					if nodeMachineType != "" {
-						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), nodeMachineType, "spec", "machineType"); err != nil {
-							return err
-						}
+					if err := validateCAPG(kinds, project, region); err != nil {
+						return err
 					}
-
-				} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
-					ri.Object.GetKind() == "MachinePool" {
-					foundMP = true
-
-					if err = SetMPConfiguration(ri, deafultMachinePoolName, minSize, maxSize); err != nil {
+					if err := coreOpts.validateKinds(kinds); err != nil {
 						return err
 					}
-				} else if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1beta1" &&
-					ri.Object.GetKind() == "GCPManagedControlPlane" {
-					if clusterName != "" {
-						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), clusterName, "spec", "clusterName"); err != nil {
-							return err
+				}
+				out, err := ioOpts.processResources(in, coreOpts.apply, func(ri parser.ResourceInfo) error {
+					if ri.Object.GetAPIVersion() == infraApiVersion &&
+						ri.Object.GetKind() == "GCPManagedCluster" {
+						foundCP = true
+
+						if project != "" {
+							if err = setField(ri, project, "spec", "project"); err != nil {
+								return err
+							}
 						}
-					}
-					if kubernetesVersion != "" {
-						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), kubernetesVersion, "spec", "controlPlaneVersion"); err != nil {
+						if region != "" {
+							if err = setField(ri, region, "spec", "region"); err != nil {
+								return err
+							}
+						}
+						if subnetCidr != "" {
+							if err = SetGCPNetworkConfiguration(ri, subnetCidr); err != nil {
+								return err
+							}
+						}
+
+					} else if ri.Object.GetAPIVersion() == infraApiVersion &&
+						ri.Object.GetKind() == "GCPManagedMachinePool" {
+						foundManagedMP = true
+
+						if err = SetGCPManagedMPConfiguration(ri, deafultMachinePoolName, minSize, maxSize, &ioOpts.warnings); err != nil {
 							return err
 						}
-						if err = unstructured.SetNestedField(ri.Object.UnstructuredContent(), "stable", "spec", "releaseChannel"); err != nil {
+						if nodeMachineType != "" {
+							if err = setField(ri, nodeMachineType, "spec", "machineType"); err != nil {
+								return err
+							}
+						}
+
+					} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
+						ri.Object.GetKind() == "MachinePool" {
+						foundMP = true
+
+						if err = SetMPConfiguration(ri, deafultMachinePoolName, minSize, maxSize, &ioOpts.warnings); err != nil {
 							return err
 						}
+					} else if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1beta1" &&
+						ri.Object.GetKind() == gcpManagedControlPlaneKind {
+						isFound[gcpManagedControlPlaneKind] = true
+						if project != "" {
+							if err = setField(ri, project, "spec", "project"); err != nil {
+								return err
+							}
+						}
+						if region != "" {
+							if err = setField(ri, region, "spec", "location"); err != nil {
+								return err
+							}
+						}
+						if clusterName != "" {
+							if err = setField(ri, clusterName, "spec", "clusterName"); err != nil {
+								return err
+							}
+						}
+						if kubernetesVersion != "" {
+							if err = setField(ri, kubernetesVersion, "spec", "controlPlaneVersion"); err != nil {
+								return err
+							}
+							if err = setField(ri, "stable", "spec", "releaseChannel"); err != nil {
+								return err
+							}
+						}
 					}
-				}
 
-				data, err := yaml.Marshal(ri.Object)
+					return nil
+				}, coreOpts.pause, transformOpts.apply)
 				if err != nil {
 					return err
 				}
-				if out.Len() > 0 {
-					out.WriteString("---\n")
+				if !foundCP {
+					return errors.New("control plane not found, check apiVersion")
+				}
+				if !foundMP {
+					return errors.New("MachinePool not found")
+				}
+				if !foundManagedMP {
+					return errors.New("GCPManagedMachinePool not found")
+				}
+				if err := transformOpts.validate(); err != nil {
+					return err
+				}
+				if !ioOpts.validateFirst() {
+					if err := validateCAPG(isFound, project, region); err != nil {
+						return err
+					}
+					if err := coreOpts.validate(); err != nil {
+						return err
+					}
+				}
+
+				if err := ioOpts.warnings.flush(ioOpts.quiet, ioOpts.strict); err != nil {
+					return err
 				}
-				_, err = out.Write(data)
-				return err
+				return ioOpts.write(out)
 			})
-			if err != nil {
-				return err
-			}
-			if !foundCP {
-				return errors.New("control plane not found, check apiVersion")
-			}
-			if !foundMP {
-				return errors.New("MachinePool not found")
-			}
-			if !foundManagedMP {
-				return errors.New("GCPManagedMachinePool not found")
-			}
-			_, err = os.Stdout.Write(out.Bytes())
-			return err
 		},
 	}
 	cmd.Flags().Int64Var(&minSize, "min-count", 3, "Minimum count of nodes in nodepool")
 	cmd.Flags().Int64Var(&maxSize, "max-count", 6, "Maximum count of nodes in nodepool")
+	cmd.Flags().StringVar(&project, "project", "", "GCP project ID set on GCPManagedControlPlane and GCPManagedCluster")
+	cmd.Flags().StringVar(&region, "region", "", "GCP region set as location of GCPManagedControlPlane and region of GCPManagedCluster")
+	coreOpts.AddFlags(cmd.Flags())
+	transformOpts.AddFlags(cmd.Flags())
+	ioOpts.AddFlags(cmd.Flags())
 	return cmd
 }
 
-func SetGCPManagedMPConfiguration(ri parser.ResourceInfo, name string, minSize int64, maxSize int64) error {
-	scalingCfg := map[string]any{
-		"minCount": minSize,
-		"maxCount": maxSize,
-	}
-	if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), scalingCfg, "spec", "scaling"); err != nil {
-		return err
+func SetGCPManagedMPConfiguration(ri parser.ResourceInfo, name string, minSize int64, maxSize int64, w *warnings) error {
+	if !skipped(ri.Object, skipScaling) {
+		scalingCfg := map[string]any{
+			"minCount": minSize,
+			"maxCount": maxSize,
+		}
+		if err := setField(ri, scalingCfg, "spec", "scaling"); err != nil {
+			return err
+		}
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), name, "metadata", "name"); err != nil {
+	if err := setName(ri, name, w); err != nil {
 		return err
 	}
 	return nil
 }
 
 func SetGCPNetworkConfiguration(ri parser.ResourceInfo, subnetCidr string) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
 	networkName, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "network", "name")
 	if err != nil {
 		return err
@@ -172,10 +276,10 @@ func SetGCPNetworkConfiguration(ri parser.ResourceInfo, subnetCidr string) error
 		},
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), false, "spec", "network", "autoCreateSubnetworks"); err != nil {
+	if err := setField(ri, false, "spec", "network", "autoCreateSubnetworks"); err != nil {
 		return err
 	}
-	if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), subnets, "spec", "network", "subnets"); err != nil {
+	if err := setField(ri, subnets, "spec", "network", "subnets"); err != nil {
 		return err
 	}
 	return nil
@@ -17,115 +17,217 @@ limitations under the License.
 package config
 
 import (
-	"bytes"
-	"io"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"kmodules.xyz/client-go/tools/parser"
-	"sigs.k8s.io/yaml"
 )
 
+// bootstrapCheckStrategies are the allowed values of
+// virtualMachineBootstrapCheck.checkStrategy.
+var bootstrapCheckStrategies = map[string]bool{
+	"none": true,
+	"ssh":  true,
+}
+
 type machineSpecs struct {
 	cpu, socket, threads int64
 	memory               string
 }
 
 func NewCmdCAPK() *cobra.Command {
+	var coreOpts coreOptions
+	var transformOpts transformOptions
+	var ioOpts ioOptions
+	var checkStrategy, checkTimeout string
+	var cpu, memory string
 	cmd := &cobra.Command{
 		Use:               "capk",
 		Short:             "Configure CAPK config",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			in, err := io.ReadAll(os.Stdin)
-			if err != nil {
-				return err
-			}
+			return ioOpts.run(func() error {
+				coreOpts.reset()
+				transformOpts.reset()
+				if err := ioOpts.printEffectiveConfig(cmd.LocalFlags(), "CONTROL_PLANE_MACHINE_CPU", "CONTROL_PLANE_MACHINE_MEMORY", "WORKER_MACHINE_CPU", "WORKER_MACHINE_MEMORY"); err != nil {
+					return err
+				}
+				if !bootstrapCheckStrategies[checkStrategy] {
+					return fmt.Errorf("invalid bootstrap check strategy %q", checkStrategy)
+				}
+				if checkTimeout != "" {
+					if _, err := time.ParseDuration(checkTimeout); err != nil {
+						return fmt.Errorf("invalid bootstrap check timeout %q, expected a duration like 10m", checkTimeout)
+					}
+				}
+				if cpu != "" {
+					if _, err := resource.ParseQuantity(cpu); err != nil {
+						return fmt.Errorf("invalid cpu quantity %q", cpu)
+					}
+				}
+				if memory != "" {
+					if _, err := resource.ParseQuantity(memory); err != nil {
+						return fmt.Errorf("invalid memory quantity %q", memory)
+					}
+				}
+				in, err := ioOpts.readInput()
+				if err != nil {
+					return err
+				}
 
-			var out bytes.Buffer
-			cpCPU, err := strconv.ParseInt(os.Getenv("CONTROL_PLANE_MACHINE_CPU"), 10, 64)
-			if err != nil {
-				return err
-			}
-			cpMemory := os.Getenv("CONTROL_PLANE_MACHINE_MEMORY") + "Gi"
-			wmCPU, err := strconv.ParseInt(os.Getenv("WORKER_MACHINE_CPU"), 10, 64)
-			if err != nil {
-				return err
-			}
-			wmMemory := os.Getenv("WORKER_MACHINE_MEMORY") + "Gi"
+				cpCPU, err := strconv.ParseInt(os.Getenv("CONTROL_PLANE_MACHINE_CPU"), 10, 64)
+				if err != nil {
+					return err
+				}
+				cpMemory := os.Getenv("CONTROL_PLANE_MACHINE_MEMORY") + "Gi"
+				wmCPU, err := strconv.ParseInt(os.Getenv("WORKER_MACHINE_CPU"), 10, 64)
+				if err != nil {
+					return err
+				}
+				wmMemory := os.Getenv("WORKER_MACHINE_MEMORY") + "Gi"
 
-			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
-				if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1alpha1" &&
-					ri.Object.GetKind() == "KubevirtCluster" {
-					if err := setControlPlaneServiceTemplate(ri); err != nil {
+				if err := coreOpts.validateFlags(); err != nil {
+					return err
+				}
+				if ioOpts.validateFirst() {
+					kinds, err := ioOpts.kinds(in, nil)
+					if err != nil {
 						return err
 					}
-				} else if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1alpha1" &&
-					ri.Object.GetKind() == "KubevirtMachineTemplate" {
-
-					if err := setBootstrapCheckStrategy(ri); err != nil {
+					if err := coreOpts.validateKinds(kinds); err != nil {
 						return err
 					}
+				}
+				var foundMT bool
+				out, err := ioOpts.processResources(in, coreOpts.apply, func(ri parser.ResourceInfo) error {
+					if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1alpha1" &&
+						ri.Object.GetKind() == "KubevirtCluster" {
+						if err := setControlPlaneServiceTemplate(ri); err != nil {
+							return err
+						}
+					} else if ri.Object.GetAPIVersion() == "infrastructure.cluster.x-k8s.io/v1alpha1" &&
+						ri.Object.GetKind() == "KubevirtMachineTemplate" {
+						foundMT = true
 
-					if strings.HasSuffix(ri.Object.GetName(), "control-plane") {
-						if err := setControlPlaneCpuMemory(ri, &machineSpecs{
-							cpu:     cpCPU,
-							memory:  cpMemory,
-							socket:  1,
-							threads: 1,
-						}); err != nil {
+						if err := setBootstrapCheckStrategy(ri, checkStrategy, checkTimeout); err != nil {
 							return err
 						}
-					} else {
-						if err := setWorkerMachineCpuMemory(ri, &machineSpecs{
-							cpu:     wmCPU,
-							memory:  wmMemory,
-							socket:  1,
-							threads: 1,
-						}); err != nil {
+
+						if strings.HasSuffix(resourceName(ri), "control-plane") {
+							if err := setControlPlaneCpuMemory(ri, &machineSpecs{
+								cpu:     cpCPU,
+								memory:  cpMemory,
+								socket:  1,
+								threads: 1,
+							}); err != nil {
+								return err
+							}
+						} else {
+							if err := setWorkerMachineCpuMemory(ri, &machineSpecs{
+								cpu:     wmCPU,
+								memory:  wmMemory,
+								socket:  1,
+								threads: 1,
+							}); err != nil {
+								return err
+							}
+						}
+						if err := setVMResources(ri, cpu, memory); err != nil {
 							return err
 						}
 					}
-				}
 
-				data, err := yaml.Marshal(ri.Object)
+					return nil
+				}, coreOpts.pause, transformOpts.apply)
 				if err != nil {
 					return err
 				}
-				if out.Len() > 0 {
-					out.WriteString("---\n")
+
+				// Without the flags of the templates the manifest passes
+				// through unchanged.
+				if !foundMT && (cpu != "" || memory != "" || checkTimeout != "" || cmd.Flags().Changed("bootstrap-check-strategy")) {
+					return errors.New("failed to get KubevirtMachineTemplate for configuration")
+				}
+				if err := transformOpts.validate(); err != nil {
+					return err
+				}
+				if !ioOpts.validateFirst() {
+					if err := coreOpts.validate(); err != nil {
+						return err
+					}
 				}
-				_, err = out.Write(data)
-				return err
-			})
-			if err != nil {
-				return err
-			}
 
-			_, err = os.Stdout.Write(out.Bytes())
-			return err
+				if err := ioOpts.warnings.flush(ioOpts.quiet, ioOpts.strict); err != nil {
+					return err
+				}
+				return ioOpts.write(out)
+			})
 		},
 	}
+	cmd.Flags().StringVar(&cpu, "cpu", "", "CPU request and limit of the KubevirtMachineTemplate virtual machines, and their CPU cores rounded up, overriding the CPU count of the environment")
+	cmd.Flags().StringVar(&memory, "memory", "", "Memory request and limit of the KubevirtMachineTemplate virtual machines as a quantity like 4Gi, overriding the memory of the environment")
+	cmd.Flags().StringVar(&checkStrategy, "bootstrap-check-strategy", "none", "Bootstrap check strategy of the KubevirtMachineTemplate virtual machines, none or ssh")
+	cmd.Flags().StringVar(&checkTimeout, "bootstrap-check-timeout", "", "Bootstrap check timeout of the KubevirtMachineTemplate virtual machines as a duration like 10m (unset when empty)")
+	coreOpts.AddFlags(cmd.Flags())
+	transformOpts.AddFlags(cmd.Flags())
+	ioOpts.AddFlags(cmd.Flags())
 
 	return cmd
 }
 
-func setBootstrapCheckStrategy(ri parser.ResourceInfo) error {
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), "none", "spec", "template", "spec", "virtualMachineBootstrapCheck", "checkStrategy"); err != nil {
+func setBootstrapCheckStrategy(ri parser.ResourceInfo, strategy, timeout string) error {
+	if err := setField(ri, strategy, "spec", "template", "spec", "virtualMachineBootstrapCheck", "checkStrategy"); err != nil {
 		return err
 	}
+	if timeout != "" {
+		if err := setField(ri, timeout, "spec", "template", "spec", "virtualMachineBootstrapCheck", "timeout"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setVMResources sets the non-empty cpu and memory as resource requests and
+// limits of the virtual machines of a KubevirtMachineTemplate. The limits
+// are set as well, so that the requests don't exceed the limits from the
+// environment, and so are the CPU cores, rounded up to whole cores, so that
+// the guest sees the requested CPUs.
+func setVMResources(ri parser.ResourceInfo, cpu, memory string) error {
+	if cpu != "" {
+		q, err := resource.ParseQuantity(cpu)
+		if err != nil {
+			return fmt.Errorf("invalid cpu quantity %q", cpu)
+		}
+		if err := setField(ri, q.Value(), "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "cpu", "cores"); err != nil {
+			return err
+		}
+	}
+	for name, value := range map[string]string{"cpu": cpu, "memory": memory} {
+		if value == "" {
+			continue
+		}
+		for _, field := range []string{"requests", "limits"} {
+			if err := setField(ri, value, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", field, name); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
 func setControlPlaneServiceTemplate(ri parser.ResourceInfo) error {
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), "0.0.0.0", "spec", "controlPlaneServiceTemplate", "metadata", "annotations", "kube-vip.io/loadbalancerIPs"); err != nil {
+	if err := setField(ri, "0.0.0.0", "spec", "controlPlaneServiceTemplate", "metadata", "annotations", "kube-vip.io/loadbalancerIPs"); err != nil {
 		return err
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), "LoadBalancer", "spec", "controlPlaneServiceTemplate", "spec", "type"); err != nil {
+	if err := setField(ri, "LoadBalancer", "spec", "controlPlaneServiceTemplate", "spec", "type"); err != nil {
 		return err
 	}
 	return nil
@@ -137,7 +239,7 @@ func setControlPlaneCpuMemory(ri parser.ResourceInfo, specs *machineSpecs) error
 		"sockets": specs.socket,
 		"threads": specs.threads,
 	}
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), cpu, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "cpu"); err != nil {
+	if err := setField(ri, cpu, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "cpu"); err != nil {
 		return err
 	}
 
@@ -148,11 +250,11 @@ func setControlPlaneCpuMemory(ri parser.ResourceInfo, specs *machineSpecs) error
 		"memory": specs.memory,
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "limits"); err != nil {
+	if err := setField(ri, resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "limits"); err != nil {
 		return err
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "requests"); err != nil {
+	if err := setField(ri, resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "requests"); err != nil {
 		return err
 	}
 	return nil
@@ -164,7 +266,7 @@ func setWorkerMachineCpuMemory(ri parser.ResourceInfo, specs *machineSpecs) erro
 		"sockets": specs.socket,
 		"threads": specs.threads,
 	}
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), cpu, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "cpu"); err != nil {
+	if err := setField(ri, cpu, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "cpu"); err != nil {
 		return err
 	}
 	unstructured.RemoveNestedField(ri.Object.UnstructuredContent(), "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "memory")
@@ -174,11 +276,11 @@ func setWorkerMachineCpuMemory(ri parser.ResourceInfo, specs *machineSpecs) erro
 		"memory": specs.memory,
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "limits"); err != nil {
+	if err := setField(ri, resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "limits"); err != nil {
 		return err
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "requests"); err != nil {
+	if err := setField(ri, resources, "spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain", "resources", "requests"); err != nil {
 		return err
 	}
 	return nil
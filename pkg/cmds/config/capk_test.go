@@ -0,0 +1,94 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestSetVMResources(t *testing.T) {
+	domainPath := []string{"spec", "template", "spec", "virtualMachineTemplate", "spec", "template", "spec", "domain"}
+	tests := []struct {
+		name          string
+		cpu, memory   string
+		wantCPU       map[string]any
+		wantResources map[string]any
+	}{
+		{
+			name:    "whole cores",
+			cpu:     "4",
+			wantCPU: map[string]any{"cores": int64(4), "sockets": int64(1), "threads": int64(1)},
+			wantResources: map[string]any{
+				"requests": map[string]any{"cpu": "4"},
+				"limits":   map[string]any{"cpu": "4"},
+			},
+		},
+		{
+			name:    "millicores rounded up",
+			cpu:     "1500m",
+			wantCPU: map[string]any{"cores": int64(2), "sockets": int64(1), "threads": int64(1)},
+			wantResources: map[string]any{
+				"requests": map[string]any{"cpu": "1500m"},
+				"limits":   map[string]any{"cpu": "1500m"},
+			},
+		},
+		{
+			name:    "memory only",
+			memory:  "8Gi",
+			wantCPU: map[string]any{"cores": int64(2), "sockets": int64(1), "threads": int64(1)},
+			wantResources: map[string]any{
+				"requests": map[string]any{"memory": "8Gi"},
+				"limits":   map[string]any{"memory": "8Gi"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion("infrastructure.cluster.x-k8s.io/v1alpha1")
+			obj.SetKind("KubevirtMachineTemplate")
+			obj.SetName("capi-md-0")
+			ri := parser.ResourceInfo{Object: obj}
+			if err := setField(ri, map[string]any{"cores": 2, "sockets": 1, "threads": 1}, append(domainPath, "cpu")...); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := setVMResources(ri, tt.cpu, tt.memory); err != nil {
+				t.Fatal(err)
+			}
+			domain, _, err := unstructured.NestedMap(obj.Object, domainPath...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(domain["cpu"], tt.wantCPU) {
+				t.Errorf("domain.cpu = %v, want %v", domain["cpu"], tt.wantCPU)
+			}
+			if !reflect.DeepEqual(domain["resources"], tt.wantResources) {
+				t.Errorf("domain.resources = %v, want %v", domain["resources"], tt.wantResources)
+			}
+		})
+	}
+
+	ri := parser.ResourceInfo{Object: &unstructured.Unstructured{Object: map[string]any{"kind": "KubevirtMachineTemplate"}}}
+	if err := setVMResources(ri, "two", ""); err == nil || err.Error() != `invalid cpu quantity "two"` {
+		t.Errorf("setVMResources() error = %v, want invalid cpu quantity", err)
+	}
+}
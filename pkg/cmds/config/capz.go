@@ -17,19 +17,20 @@ limitations under the License.
 package config
 
 import (
-	"bytes"
 	"errors"
-	"io"
+	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"kmodules.xyz/client-go/tools/parser"
-	"sigs.k8s.io/yaml"
 )
 
+var azureSubscriptionIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-([0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}$`)
+
 func NewCmdCAPZ() *cobra.Command {
 	var (
 		systemMPMinSize int64
@@ -37,142 +38,177 @@ func NewCmdCAPZ() *cobra.Command {
 
 		userMPMinSize int64
 		userMPMaxSize int64
+
+		subscriptionID string
+
+		coreOpts      coreOptions
+		transformOpts transformOptions
+		ioOpts        ioOptions
 	)
 	cmd := &cobra.Command{
 		Use:               "capz",
 		Short:             "Configure CAPZ config",
 		DisableAutoGenTag: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			in, err := io.ReadAll(os.Stdin)
-			if err != nil {
-				return err
-			}
-
-			var out bytes.Buffer
-			var foundCP bool
-			var foundUserManagedMP bool
-			var foundSysMP bool
-			var foundSysManagedMP bool
-			var foundUserMP bool
-			err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
-				if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "AzureManagedControlPlane" {
-					foundCP = true
-
-					if err := SetAzureNetworkConfiguration(ri); err != nil {
-						return err
-					}
-
-				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "AzureManagedMachinePool" {
+			return ioOpts.run(func() error {
+				coreOpts.reset()
+				transformOpts.reset()
+				if err := ioOpts.printEffectiveConfig(cmd.LocalFlags(), "VNET_CIDR", "SUBNET_CIDR", "AZURE_CLUSTER_IDENTITY_SECRET_NAME", "AZURE_CLUSTER_IDENTITY_SECRET_NAMESPACE"); err != nil {
+					return err
+				}
+				in, err := ioOpts.readInput()
+				if err != nil {
+					return err
+				}
 
-					mode, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "mode")
+				var foundCP bool
+				var foundUserManagedMP bool
+				var foundSysMP bool
+				var foundSysManagedMP bool
+				var foundUserMP bool
+				if systemMPMinSize > systemMPMaxSize || userMPMinSize > userMPMaxSize {
+					return errors.New("max node count can't be less than min node count")
+				}
+				if subscriptionID != "" && !azureSubscriptionIDRegex.MatchString(subscriptionID) {
+					return fmt.Errorf("invalid subscription id %q, expected a GUID", subscriptionID)
+				}
+				if err := coreOpts.validateFlags(); err != nil {
+					return err
+				}
+				if ioOpts.validateFirst() {
+					kinds, err := ioOpts.kinds(in, nil)
 					if err != nil {
 						return err
 					}
-					if !ok {
-						return errors.New("mode in spec of AzureManagedMachinePool is missing")
+					if err := coreOpts.validateKinds(kinds); err != nil {
+						return err
 					}
+				}
+				out, err := ioOpts.processResources(in, coreOpts.apply, func(ri parser.ResourceInfo) error {
+					if ri.Object.GetAPIVersion() == infraApiVersion &&
+						ri.Object.GetKind() == "AzureManagedControlPlane" {
+						foundCP = true
 
-					var minSize int64
-					var maxSize int64
-					var newName string
-					if mode == "System" {
-						foundSysManagedMP = true
-						minSize = systemMPMinSize
-						maxSize = systemMPMaxSize
-						newName = "sys0"
-
-					} else if mode == "User" {
-						foundUserManagedMP = true
-						minSize = userMPMinSize
-						maxSize = userMPMaxSize
-						newName = deafultMachinePoolName
-					}
+						if err := SetAzureNetworkConfiguration(ri); err != nil {
+							return err
+						}
+						if subscriptionID != "" {
+							if err := setField(ri, subscriptionID, "spec", "subscriptionID"); err != nil {
+								return err
+							}
+						}
 
-					if err := SetAzureManagedMPConfiguration(ri, newName, mode, minSize, maxSize); err != nil {
-						return err
-					}
+					} else if ri.Object.GetAPIVersion() == infraApiVersion &&
+						ri.Object.GetKind() == "AzureManagedMachinePool" {
 
-				} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
-					ri.Object.GetKind() == "MachinePool" {
+						mode, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "mode")
+						if err != nil {
+							return err
+						}
+						if !ok {
+							return errors.New("mode in spec of AzureManagedMachinePool is missing")
+						}
 
-					name, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "metadata", "name")
-					if err != nil {
-						return err
-					}
-					if !ok {
-						return errors.New("name in MachinePool is missing")
-					}
-					mode := strings.HasSuffix(name, "pool0")
-
-					var newName string
-					var minSize int64
-					var maxSize int64
-					if mode {
-						foundSysMP = true
-						minSize = systemMPMinSize
-						maxSize = systemMPMaxSize
-						newName = "sys0"
-					} else {
-						foundUserMP = true
-						minSize = userMPMinSize
-						maxSize = userMPMaxSize
-						newName = "default"
-					}
-					if err := SetMPConfiguration(ri, newName, minSize, maxSize); err != nil {
-						return err
-					}
+						var minSize int64
+						var maxSize int64
+						var newName string
+						if mode == "System" {
+							foundSysManagedMP = true
+							minSize = systemMPMinSize
+							maxSize = systemMPMaxSize
+							newName = "sys0"
 
-				} else if ri.Object.GetAPIVersion() == infraApiVersion &&
-					ri.Object.GetKind() == "AzureClusterIdentity" {
+						} else if mode == "User" {
+							foundUserManagedMP = true
+							minSize = userMPMinSize
+							maxSize = userMPMaxSize
+							newName = deafultMachinePoolName
+						}
 
-					clientSecretName := os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAME")
-					clientSecretNamespace := os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAMESPACE")
+						if err := SetAzureManagedMPConfiguration(ri, newName, mode, minSize, maxSize, &ioOpts.warnings); err != nil {
+							return err
+						}
 
-					if clientSecretNamespace != "" && clientSecretName != "" {
-						clientSecret := map[string]any{
-							"name":      clientSecretName,
-							"namespace": clientSecretNamespace,
+					} else if ri.Object.GetAPIVersion() == clusterApiVersion &&
+						ri.Object.GetKind() == "MachinePool" {
+
+						name := resourceName(ri)
+						if name == "" {
+							return errors.New("name in MachinePool is missing")
 						}
-						if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), clientSecret, "spec", "clientSecret"); err != nil {
+						mode := strings.HasSuffix(name, "pool0")
+
+						var newName string
+						var minSize int64
+						var maxSize int64
+						if mode {
+							foundSysMP = true
+							minSize = systemMPMinSize
+							maxSize = systemMPMaxSize
+							newName = "sys0"
+						} else {
+							foundUserMP = true
+							minSize = userMPMinSize
+							maxSize = userMPMaxSize
+							newName = "default"
+						}
+						if err := SetMPConfiguration(ri, newName, minSize, maxSize, &ioOpts.warnings); err != nil {
 							return err
 						}
+
+					} else if ri.Object.GetAPIVersion() == infraApiVersion &&
+						ri.Object.GetKind() == "AzureClusterIdentity" {
+
+						clientSecretName := os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAME")
+						clientSecretNamespace := os.Getenv("AZURE_CLUSTER_IDENTITY_SECRET_NAMESPACE")
+
+						if clientSecretNamespace != "" && clientSecretName != "" {
+							clientSecret := map[string]any{
+								"name":      clientSecretName,
+								"namespace": clientSecretNamespace,
+							}
+							if err := setField(ri, clientSecret, "spec", "clientSecret"); err != nil {
+								return err
+							}
+						}
 					}
-				}
 
-				data, err := yaml.Marshal(ri.Object)
+					return nil
+				}, coreOpts.pause, transformOpts.apply)
 				if err != nil {
 					return err
 				}
-				if out.Len() > 0 {
-					out.WriteString("---\n")
+
+				if !foundCP {
+					return errors.New("control plane not found, check apiVersion")
+				}
+				if !foundSysManagedMP {
+					return errors.New("system AzureManagedMachinePool not found")
 				}
-				_, err = out.Write(data)
-				return err
+				if !foundUserManagedMP {
+					return errors.New("user AzureManagedMachinePool not found")
+				}
+				if !foundSysMP {
+					return errors.New("system MachinePool not found")
+				}
+				if !foundUserMP {
+					return errors.New("user MachinePool not found")
+				}
+
+				if err := transformOpts.validate(); err != nil {
+					return err
+				}
+				if !ioOpts.validateFirst() {
+					if err := coreOpts.validate(); err != nil {
+						return err
+					}
+				}
+
+				if err := ioOpts.warnings.flush(ioOpts.quiet, ioOpts.strict); err != nil {
+					return err
+				}
+				return ioOpts.write(out)
 			})
-			if err != nil {
-				return err
-			}
-
-			if !foundCP {
-				return errors.New("control plane not found, check apiVersion")
-			}
-			if !foundSysManagedMP {
-				return errors.New("system AzureManagedMachinePool not found")
-			}
-			if !foundUserManagedMP {
-				return errors.New("user AzureManagedMachinePool not found")
-			}
-			if !foundSysMP {
-				return errors.New("system MachinePool not found")
-			}
-			if !foundUserMP {
-				return errors.New("user MachinePool not found")
-			}
-
-			_, err = os.Stdout.Write(out.Bytes())
-			return err
 		},
 	}
 
@@ -181,10 +217,14 @@ func NewCmdCAPZ() *cobra.Command {
 
 	cmd.Flags().Int64Var(&userMPMinSize, "user-min-size", 2, "Minimum node count for User Machine Pool")
 	cmd.Flags().Int64Var(&userMPMaxSize, "user-max-size", 5, "Minimum node count for User Machine Pool")
+	cmd.Flags().StringVar(&subscriptionID, "subscription-id", "", "Azure subscription ID set on AzureManagedControlPlane")
+	coreOpts.AddFlags(cmd.Flags())
+	transformOpts.AddFlags(cmd.Flags())
+	ioOpts.AddFlags(cmd.Flags())
 	return cmd
 }
 
-func SetAzureManagedMPConfiguration(ri parser.ResourceInfo, name string, mode string, minSize int64, maxSize int64) error {
+func SetAzureManagedMPConfiguration(ri parser.ResourceInfo, name string, mode string, minSize int64, maxSize int64, w *warnings) error {
 	if mode == "System" {
 		taint := map[string]any{
 			"key":    "CriticalAddonsOnly",
@@ -192,29 +232,34 @@ func SetAzureManagedMPConfiguration(ri parser.ResourceInfo, name string, mode st
 			"effect": "NoSchedule",
 		}
 		taints := []interface{}{taint}
-		if err := unstructured.SetNestedSlice(ri.Object.UnstructuredContent(), taints, "spec", "taints"); err != nil {
+		if err := setField(ri, taints, "spec", "taints"); err != nil {
 			return err
 		}
 	}
 
-	scalingCfg := map[string]any{
-		"minSize": minSize,
-		"maxSize": maxSize,
-	}
-	if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), scalingCfg, "spec", "scaling"); err != nil {
-		return err
+	if !skipped(ri.Object, skipScaling) {
+		scalingCfg := map[string]any{
+			"minSize": minSize,
+			"maxSize": maxSize,
+		}
+		if err := setField(ri, scalingCfg, "spec", "scaling"); err != nil {
+			return err
+		}
 	}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), name, "metadata", "name"); err != nil {
+	if err := setName(ri, name, w); err != nil {
 		return err
 	}
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), name, "spec", "name"); err != nil {
+	if err := setField(ri, name, "spec", "name"); err != nil {
 		return err
 	}
 	return nil
 }
 
 func SetAzureNetworkConfiguration(ri parser.ResourceInfo) error {
+	if skipped(ri.Object, skipNetwork) {
+		return nil
+	}
 	resourceGroupName, ok, err := unstructured.NestedString(ri.Object.UnstructuredContent(), "spec", "resourceGroupName")
 	if err != nil {
 		return err
@@ -236,7 +281,7 @@ func SetAzureNetworkConfiguration(ri parser.ResourceInfo) error {
 			"cidrBlock": subnetCidr,
 		},
 	}
-	if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), netcfg, "spec", "virtualNetwork"); err != nil {
+	if err := setField(ri, netcfg, "spec", "virtualNetwork"); err != nil {
 		return err
 	}
 	return nil
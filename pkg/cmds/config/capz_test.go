@@ -0,0 +1,112 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// runCAPZ runs the capz command on testdata/aks.yaml and returns the
+// resulting resources keyed by Kind/name.
+func runCAPZ(t *testing.T, args ...string) (map[string]*unstructured.Unstructured, error) {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "out.yaml")
+	cmd := NewCmdCAPZ()
+	cmd.SetArgs(append([]string{"-f", "testdata/aks.yaml", "-o", out}, args...))
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	if err := cmd.Execute(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs := make(map[string]*unstructured.Unstructured)
+	err = parser.ProcessResources(data, func(ri parser.ResourceInfo) error {
+		objs[ri.Object.GetKind()+"/"+ri.Object.GetName()] = ri.Object
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objs, nil
+}
+
+func TestCAPZScaling(t *testing.T) {
+	objs, err := runCAPZ(t, "--system-min-size=1", "--system-max-size=3", "--user-min-size=2", "--user-max-size=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pool     string
+		min, max int64
+	}{
+		{pool: "AzureManagedMachinePool/sys0", min: 1, max: 3},
+		{pool: "AzureManagedMachinePool/default", min: 2, max: 8},
+	}
+	for _, tt := range tests {
+		obj, ok := objs[tt.pool]
+		if !ok {
+			t.Errorf("%s not found in the output", tt.pool)
+			continue
+		}
+		minSize, _, _ := unstructured.NestedInt64(obj.Object, "spec", "scaling", "minSize")
+		maxSize, _, _ := unstructured.NestedInt64(obj.Object, "spec", "scaling", "maxSize")
+		if minSize != tt.min || maxSize != tt.max {
+			t.Errorf("%s spec.scaling = %d/%d, want %d/%d", tt.pool, minSize, maxSize, tt.min, tt.max)
+		}
+	}
+}
+
+func TestCAPZSubscriptionID(t *testing.T) {
+	const id = "0b1f6471-1bf0-4dda-aec3-111122223333"
+	objs, err := runCAPZ(t, "--subscription-id="+id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, ok := objs["AzureManagedControlPlane/capi-control-plane"]
+	if !ok {
+		t.Fatal("AzureManagedControlPlane not found in the output")
+	}
+	if got, _, _ := unstructured.NestedString(cp.Object, "spec", "subscriptionID"); got != id {
+		t.Errorf("spec.subscriptionID = %q, want %q", got, id)
+	}
+}
+
+func TestCAPZValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "system min above max", args: []string{"--system-min-size=3", "--system-max-size=2"}},
+		{name: "user min above max", args: []string{"--user-min-size=6", "--user-max-size=5"}},
+		{name: "invalid subscription id", args: []string{"--subscription-id=not-a-guid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := runCAPZ(t, tt.args...); err == nil {
+				t.Error("capz accepted the invalid flags")
+			}
+		})
+	}
+}
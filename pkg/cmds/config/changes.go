@@ -0,0 +1,105 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// ChangeFunc is called for every field changed by the mutations, with the
+// resource as Kind/name, the dotted path of the field and its old and new
+// value. Added fields have a nil old value and removed fields a nil new
+// value. Lists are reported as a whole.
+type ChangeFunc func(resource, path string, old, new any)
+
+// trackChanges returns a ResourceFn that runs fns and reports the fields
+// they changed to onChange, in path order.
+func trackChanges(onChange ChangeFunc, fns ...parser.ResourceFn) parser.ResourceFn {
+	return func(ri parser.ResourceInfo) error {
+		resource := ri.Object.GetKind() + "/" + resourceName(ri)
+		orig := ri.Object.DeepCopy().UnstructuredContent()
+		for _, fn := range fns {
+			if err := fn(ri); err != nil {
+				return err
+			}
+		}
+		diffFields(nil, orig, ri.Object.UnstructuredContent(), func(path []string, old, new any) {
+			onChange(resource, strings.Join(path, "."), old, new)
+		})
+		return nil
+	}
+}
+
+// printChange returns a ChangeFunc that writes every change to w as a
+// line like AWSManagedControlPlane/my-cp: set spec.version=v1.29.
+func printChange(w io.Writer) ChangeFunc {
+	return func(resource, path string, old, new any) {
+		if new == nil {
+			fmt.Fprintf(w, "%s: unset %s\n", resource, path)
+			return
+		}
+		value, ok := new.(string)
+		if !ok {
+			data, err := json.Marshal(new)
+			if err != nil {
+				value = fmt.Sprint(new)
+			} else {
+				value = string(data)
+			}
+		}
+		fmt.Fprintf(w, "%s: set %s=%s\n", resource, path, value)
+	}
+}
+
+func diffFields(path []string, old, new map[string]any, report func(path []string, old, new any)) {
+	keys := make(map[string]bool, len(old)+len(new))
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		p := append(append([]string{}, path...), k)
+		o, n := old[k], new[k]
+		om, oIsMap := o.(map[string]any)
+		nm, nIsMap := n.(map[string]any)
+		switch {
+		case oIsMap && nIsMap:
+			diffFields(p, om, nm, report)
+		case oIsMap && n == nil:
+			diffFields(p, om, nil, report)
+		case o == nil && nIsMap:
+			diffFields(p, nil, nm, report)
+		case !reflect.DeepEqual(o, n):
+			report(p, o, n)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+const capaManifestYAML = `apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: capi
+  namespace: default
+---
+apiVersion: controlplane.cluster.x-k8s.io/v1beta2
+kind: AWSManagedControlPlane
+metadata:
+  name: capi-control-plane
+  namespace: default
+spec:
+  region: us-east-1
+---
+apiVersion: infrastructure.cluster.x-k8s.io/v1beta2
+kind: AWSCluster
+metadata:
+  name: capi
+  namespace: default
+---
+apiVersion: cluster.x-k8s.io/v1beta1
+kind: MachinePool
+metadata:
+  name: capi-pool-0
+  namespace: default
+spec:
+  clusterName: capi
+  template:
+    spec:
+      infrastructureRef:
+        apiVersion: infrastructure.cluster.x-k8s.io/v1beta2
+        kind: AWSManagedMachinePool
+        name: capi-pool-0
+---
+apiVersion: infrastructure.cluster.x-k8s.io/v1beta2
+kind: AWSManagedMachinePool
+metadata:
+  name: capi-pool-0
+  namespace: default
+spec:
+  scaling:
+    minSize: 1
+    maxSize: 3
+`
+
+// TestConfigureCAPAOnChange checks that OnChange is called for the fields
+// set by every helper, with the old and new value.
+func TestConfigureCAPAOnChange(t *testing.T) {
+	type change struct{ old, new any }
+	changes := make(map[string]change)
+	opts := CAPAOptions{
+		VPCCidr:                 "10.0.0.0/16",
+		ClusterName:             "capi",
+		ManagedControlplaneRole: "cp-role",
+		ManagedMachinepoolRole:  "mp-role",
+		NodeMachineType:         "m5.large",
+		MinNodeCount:            2,
+		MaxNodeCount:            6,
+		LBScheme:                "internal",
+		Quiet:                   true,
+		OnChange: func(resource, path string, old, new any) {
+			changes[resource+" "+path] = change{old, new}
+		},
+	}
+	if _, err := ConfigureCAPA([]byte(capaManifestYAML), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]change{
+		// setAWSManagedCPCIDR
+		"AWSManagedControlPlane/capi-control-plane spec.network.vpc.cidrBlock": {nil, "10.0.0.0/16"},
+		"AWSManagedControlPlane/capi-control-plane spec.roleName":              {nil, "cp-role"},
+		"AWSManagedControlPlane/capi-control-plane spec.eksClusterName":        {nil, "capi"},
+		// SetMPConfiguration
+		"MachinePool/capi-pool-0 metadata.name":                                       {"capi-pool-0", deafultMachinePoolName},
+		"MachinePool/capi-pool-0 metadata.annotations." + autoscalerMaxSizeAnnotation: {nil, "6"},
+		// setAWSManagedMPScaling
+		"AWSManagedMachinePool/capi-pool-0 spec.scaling.minSize": {int64(1), int64(2)},
+		"AWSManagedMachinePool/capi-pool-0 spec.scaling.maxSize": {int64(3), int64(6)},
+		"AWSManagedMachinePool/capi-pool-0 spec.instanceType":    {nil, "m5.large"},
+		// load balancer
+		"AWSCluster/capi spec.controlPlaneLoadBalancer.scheme": {nil, "internal"},
+		// setAWSClusterAnnotations
+		"Cluster/capi metadata.annotations." + controlplaneRoleAnnotation: {nil, "cp-role"},
+		"Cluster/capi metadata.annotations." + machinepoolRoleAnnotation:  {nil, "mp-role"},
+	}
+	for key, w := range want {
+		got, ok := changes[key]
+		if !ok {
+			t.Errorf("no change reported for %s", key)
+			continue
+		}
+		if got != w {
+			t.Errorf("change of %s = %v -> %v, want %v -> %v", key, got.old, got.new, w.old, w.new)
+		}
+	}
+	if _, ok := changes["AWSManagedControlPlane/capi-control-plane spec.region"]; ok {
+		t.Error("change reported for the unchanged spec.region")
+	}
+}
+
+func TestConfigureCAPAWithoutOnChange(t *testing.T) {
+	opts := CAPAOptions{MinNodeCount: 2, MaxNodeCount: 6}
+	withCallback := opts
+	withCallback.OnChange = func(string, string, any, any) {}
+
+	want, err := ConfigureCAPA([]byte(capaManifestYAML), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ConfigureCAPA([]byte(capaManifestYAML), withCallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("OnChange changed the output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const cidrStateLockTimeout = 30 * time.Second
+
+// cidrPoolOptions allocates non-overlapping VPC CIDRs for many clusters from
+// a shared pool. The allocations are recorded in a state file keyed by
+// cluster, so running the command again for the same cluster returns the
+// same CIDR.
+type cidrPoolOptions struct {
+	pool  string
+	size  int
+	state string
+}
+
+// cidrState is the content of the --cidr-state file.
+type cidrState struct {
+	Allocations map[string]string `json:"allocations"`
+}
+
+func (o *cidrPoolOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.pool, "cidr-pool", "", "IPv4 CIDR pool the VPC CIDR is allocated from instead of VPC_CIDR")
+	fs.IntVar(&o.size, "cidr-size", 16, "Prefix length of the VPC CIDR allocated from --cidr-pool")
+	fs.StringVar(&o.state, "cidr-state", "", "Path to the file recording the CIDRs allocated from --cidr-pool")
+}
+
+func (o *cidrPoolOptions) enabled() bool {
+	return o.pool != ""
+}
+
+// allocate returns the CIDR allocated to cluster, carving the first free one
+// from the pool if the cluster has none yet.
+func (o *cidrPoolOptions) allocate(cluster string) (string, error) {
+	if o.state == "" {
+		return "", errors.New("--cidr-state is required with --cidr-pool")
+	}
+	pool, err := netip.ParsePrefix(o.pool)
+	if err != nil {
+		return "", fmt.Errorf("invalid cidr pool %q: %w", o.pool, err)
+	}
+	if !pool.Addr().Is4() {
+		return "", fmt.Errorf("invalid cidr pool %q, only IPv4 pools are supported", o.pool)
+	}
+	pool = pool.Masked()
+	if o.size < pool.Bits() || o.size > 32 {
+		return "", fmt.Errorf("invalid cidr size %d, expected %d to 32 for pool %s", o.size, pool.Bits(), pool)
+	}
+
+	unlock, err := lockFile(o.state + ".lock")
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	var state cidrState
+	if data, err := os.ReadFile(o.state); err == nil {
+		if err := yaml.Unmarshal(data, &state); err != nil {
+			return "", fmt.Errorf("failed to parse cidr state %s: %w", o.state, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	if cidr, ok := state.Allocations[cluster]; ok {
+		return cidr, nil
+	}
+
+	allocated := make([]netip.Prefix, 0, len(state.Allocations))
+	for key, cidr := range state.Allocations {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return "", fmt.Errorf("invalid cidr %q allocated to %s in %s: %w", cidr, key, o.state, err)
+		}
+		allocated = append(allocated, p)
+	}
+	cidr, err := nextFreePrefix(pool, o.size, allocated)
+	if err != nil {
+		return "", err
+	}
+
+	if state.Allocations == nil {
+		state.Allocations = make(map[string]string)
+	}
+	state.Allocations[cluster] = cidr.String()
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(o.state, data); err != nil {
+		return "", err
+	}
+	return cidr.String(), nil
+}
+
+// nextFreePrefix returns the first subnet of pool with the given prefix
+// length that doesn't overlap any of the allocated prefixes.
+func nextFreePrefix(pool netip.Prefix, bits int, allocated []netip.Prefix) (netip.Prefix, error) {
+	base := pool.Addr().As4()
+	start := binary.BigEndian.Uint32(base[:])
+	count := uint64(1) << (bits - pool.Bits())
+	step := uint64(1) << (32 - bits)
+	for i := uint64(0); i < count; i++ {
+		var ip [4]byte
+		binary.BigEndian.PutUint32(ip[:], start+uint32(i*step))
+		candidate := netip.PrefixFrom(netip.AddrFrom4(ip), bits)
+
+		free := true
+		for _, p := range allocated {
+			if p.Overlaps(candidate) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate, nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("cidr pool %s has no free /%d left", pool, bits)
+}
+
+// lockFile takes an exclusive lock by creating path, waiting for the
+// current holder to release it. It returns the function releasing the lock.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(cidrStateLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s, remove it if no other allocation is running", path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic replaces path with data, so that readers never see a
+// partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestNextFreePrefix(t *testing.T) {
+	tests := []struct {
+		name      string
+		pool      string
+		bits      int
+		allocated []string
+		want      string
+		wantErr   bool
+	}{
+		{name: "empty pool", pool: "10.0.0.0/8", bits: 16, want: "10.0.0.0/16"},
+		{name: "skips allocated", pool: "10.0.0.0/8", bits: 16, allocated: []string{"10.0.0.0/16", "10.1.0.0/16"}, want: "10.2.0.0/16"},
+		{name: "fills a gap", pool: "10.0.0.0/8", bits: 16, allocated: []string{"10.0.0.0/16", "10.2.0.0/16"}, want: "10.1.0.0/16"},
+		{name: "skips overlapping larger prefix", pool: "10.0.0.0/8", bits: 16, allocated: []string{"10.0.0.0/15"}, want: "10.2.0.0/16"},
+		{name: "skips overlapping smaller prefix", pool: "10.0.0.0/8", bits: 16, allocated: []string{"10.0.4.0/24"}, want: "10.1.0.0/16"},
+		{name: "full pool", pool: "10.0.0.0/15", bits: 16, allocated: []string{"10.0.0.0/16", "10.1.0.0/16"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocated := make([]netip.Prefix, 0, len(tt.allocated))
+			for _, s := range tt.allocated {
+				allocated = append(allocated, netip.MustParsePrefix(s))
+			}
+			got, err := nextFreePrefix(netip.MustParsePrefix(tt.pool), tt.bits, allocated)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nextFreePrefix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("nextFreePrefix() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
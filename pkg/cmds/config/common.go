@@ -17,28 +17,171 @@ limitations under the License.
 package config
 
 import (
+	"fmt"
+	"net"
 	"strconv"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"kmodules.xyz/client-go/tools/parser"
 )
 
-func SetMPConfiguration(ri parser.ResourceInfo, name string, minSize int64, maxSize int64) error {
-	scalingCfg := map[string]any{
-		"cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size": strconv.FormatInt(minSize, 10),
-		"cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size": strconv.FormatInt(maxSize, 10),
+func validateCIDR(name, cidr string) error {
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		return fmt.Errorf("invalid %s cidr %q: %w", name, cidr, err)
 	}
+	return nil
+}
 
-	if err := unstructured.SetNestedMap(ri.Object.UnstructuredContent(), scalingCfg, "metadata", "annotations"); err != nil {
-		return err
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if errs := kvalidation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := kvalidation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid label value %q: %s", v, strings.Join(errs, "; "))
+		}
 	}
+	return nil
+}
 
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), name, "metadata", "name"); err != nil {
+// removeFixedSizeAutoscaling drops the cluster autoscaler annotations of a
+// pool whose min and max size are equal, so that the autoscaler doesn't pick
+// up fixed size pools.
+func removeFixedSizeAutoscaling(ri parser.ResourceInfo) {
+	annotations := ri.Object.GetAnnotations()
+	minSize, ok := annotations[autoscalerMinSizeAnnotation]
+	if !ok || minSize != annotations[autoscalerMaxSizeAnnotation] {
+		return
+	}
+	delete(annotations, autoscalerMinSizeAnnotation)
+	delete(annotations, autoscalerMaxSizeAnnotation)
+	delete(annotations, replicasManagedByAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	ri.Object.SetAnnotations(annotations)
+}
+
+// hasGeneratedName reports whether the name of ri is assigned by the API
+// server from metadata.generateName.
+func hasGeneratedName(ri parser.ResourceInfo) bool {
+	return ri.Object.GetName() == "" && ri.Object.GetGenerateName() != ""
+}
+
+// resourceName returns the name of ri, falling back to its generateName
+// prefix for resources that don't have a name yet.
+func resourceName(ri parser.ResourceInfo) string {
+	if hasGeneratedName(ri) {
+		return strings.TrimSuffix(ri.Object.GetGenerateName(), "-")
+	}
+	return ri.Object.GetName()
+}
+
+// setName renames ri. Resources using metadata.generateName have no stable
+// name to target, so they are left as is and only references pointing at
+// them are rewired by the callers. This means a generateName resource can't
+// be renamed by this tool; use a fixed name in the template instead.
+func setName(ri parser.ResourceInfo, name string, w *warnings) error {
+	if hasGeneratedName(ri) {
+		w.add("%s with generateName %q has no stable name, skipping rename to %q", ri.Object.GetKind(), ri.Object.GetGenerateName(), name)
+		return nil
+	}
+	return setField(ri, name, "metadata", "name")
+}
+
+const (
+	autoscalerMinSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	autoscalerMaxSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+	replicasManagedByAnnotation = "cluster.x-k8s.io/replicas-managed-by"
+)
+
+func SetMPConfiguration(ri parser.ResourceInfo, name string, minSize int64, maxSize int64, w *warnings) error {
+	if !skipped(ri.Object, skipScaling) {
+		scalingCfg := map[string]string{
+			autoscalerMinSizeAnnotation: strconv.FormatInt(minSize, 10),
+			autoscalerMaxSizeAnnotation: strconv.FormatInt(maxSize, 10),
+		}
+		for k, v := range scalingCfg {
+			if err := setField(ri, v, "metadata", "annotations", k); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := setName(ri, name, w); err != nil {
 		return err
 	}
-	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), name, "spec", "template", "spec", "infrastructureRef", "name"); err != nil {
+	if err := setField(ri, name, "spec", "template", "spec", "infrastructureRef", "name"); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// setField sets the field of ri at path to value, converting value to the
+// types used by unstructured objects first, e.g. int to int64 and []string
+// to []interface{}.
+func setField(ri parser.ResourceInfo, value any, path ...string) error {
+	v, err := toUnstructured(value)
+	if err != nil {
+		return fmt.Errorf("failed to set %s of %s: %w", strings.Join(path, "."), ri.Object.GetKind(), err)
+	}
+	if err := unstructured.SetNestedField(ri.Object.UnstructuredContent(), v, path...); err != nil {
+		return fmt.Errorf("failed to set %s of %s: %w", strings.Join(path, "."), ri.Object.GetKind(), err)
+	}
+	return nil
+}
+
+// toUnstructured converts value to one of the types allowed in unstructured
+// objects: string, bool, int64, float64, []interface{}, map[string]interface{}
+// or nil.
+func toUnstructured(value any) (any, error) {
+	switch v := value.(type) {
+	case nil, string, bool, int64, float64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case []string:
+		out := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			out = append(out, s)
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			u, err := toUnstructured(e)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, u)
+		}
+		return out, nil
+	case map[string]string:
+		out := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			out[k] = s
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			u, err := toUnstructured(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = u
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestSetMPConfigurationKeepsAnnotations(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetKind(machinePoolKind)
+	obj.SetName("capi-pool-0")
+	obj.SetAnnotations(map[string]string{
+		"example.com/owner":         "platform",
+		autoscalerMaxSizeAnnotation: "10",
+	})
+
+	var w warnings
+	if err := SetMPConfiguration(parser.ResourceInfo{Object: obj}, "default", 1, 3, &w); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"example.com/owner":         "platform",
+		autoscalerMinSizeAnnotation: "1",
+		autoscalerMaxSizeAnnotation: "3",
+	}
+	if got := obj.GetAnnotations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("annotations = %v, want %v", got, want)
+	}
+}
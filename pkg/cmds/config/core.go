@@ -0,0 +1,333 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+const (
+	kubeadmControlPlaneKind = "KubeadmControlPlane"
+	machineDeploymentKind   = "MachineDeployment"
+	clusterResourceSetKind  = "ClusterResourceSet"
+
+	pausedAnnotation = "cluster.x-k8s.io/paused"
+)
+
+// poolScalingPaths are the paths of the min and max size of the machine
+// pool kinds scaled by the provider commands.
+var poolScalingPaths = map[string][][]string{
+	"MachinePool": {
+		{"metadata", "annotations", autoscalerMinSizeAnnotation},
+		{"metadata", "annotations", autoscalerMaxSizeAnnotation},
+	},
+	"AWSManagedMachinePool":   {{"spec", "scaling", "minSize"}, {"spec", "scaling", "maxSize"}},
+	"AzureManagedMachinePool": {{"spec", "scaling", "minSize"}, {"spec", "scaling", "maxSize"}},
+	"GCPManagedMachinePool":   {{"spec", "scaling", "minCount"}, {"spec", "scaling", "maxCount"}},
+}
+
+var apiServerArgKeyRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// coreOptions holds the flags for Cluster API core kinds, shared by all
+// provider commands.
+type coreOptions struct {
+	rolloutNow   bool
+	crsSelector  map[string]string
+	crsResources []string
+
+	cpMachineLabels map[string]string
+	apiServerArgs   []string
+
+	pauseDuringScale     bool
+	bumpVersion          bool
+	bootstrapUserData    string
+	caBundle             string
+	registryMirrorConfig string
+
+	isFound          map[string]bool
+	poolScaling      map[*unstructured.Unstructured][]any
+	now              time.Time
+	userDataContent  string
+	foundUserDataCfg bool
+	airGapFiles      []bootstrapFile
+	foundAirGapCfg   bool
+}
+
+func (o *coreOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.rolloutNow, "rollout-now", false, "Trigger a rollout by setting spec.rolloutAfter to now on KubeadmControlPlane and MachineDeployment")
+	fs.StringToStringVar(&o.crsSelector, "crs-selector", nil, "Cluster labels merged into spec.clusterSelector.matchLabels of ClusterResourceSet")
+	fs.StringArrayVar(&o.crsResources, "crs-resource", nil, "Resource of ClusterResourceSet in Kind/name format, where Kind is ConfigMap or Secret")
+	fs.StringToStringVar(&o.cpMachineLabels, "cp-machine-labels", nil, "Labels merged into spec.machineTemplate.metadata.labels of KubeadmControlPlane")
+	fs.BoolVar(&o.pauseDuringScale, "pause-during-scale", false, "Add the "+pausedAnnotation+" annotation to the machine pools whose min or max size is changed, to be removed by a later step once the new size is applied")
+	fs.BoolVar(&o.bumpVersion, "bump-version", false, "Increment the minor version of spec.topology.version of Cluster and reset the patch version, e.g. v1.28.4 to v1.29.0")
+	fs.StringVar(&o.bootstrapUserData, "bootstrap-user-data", "", "Path to a script added base64 encoded to the bootstrap configs (KubeadmControlPlane, KubeadmConfigTemplate, EKSConfigTemplate) and run before the node is bootstrapped")
+	fs.StringVar(&o.caBundle, "ca-bundle", "", "Path to a PEM CA bundle added to the trusted CAs of the nodes of KubeadmControlPlane and KubeadmConfigTemplate")
+	fs.StringVar(&o.registryMirrorConfig, "registry-mirror-config", "", "Path to a containerd config.toml with registry mirrors written to /etc/containerd/config.toml on the nodes of KubeadmControlPlane and KubeadmConfigTemplate")
+	fs.StringArrayVar(&o.apiServerArgs, "apiserver-arg", nil, "API server flag merged into the kubeadm cluster configuration of KubeadmControlPlane, in key=value format without leading dashes (repeatable)")
+}
+
+// reset clears the state collected by apply, so that the input can be
+// processed again.
+func (o *coreOptions) reset() {
+	o.isFound = nil
+	o.poolScaling = nil
+	o.userDataContent = ""
+	o.foundUserDataCfg = false
+	o.airGapFiles = nil
+	o.foundAirGapCfg = false
+}
+
+func (o *coreOptions) apply(ri parser.ResourceInfo) error {
+	if o.isFound == nil {
+		o.isFound = make(map[string]bool)
+		o.poolScaling = make(map[*unstructured.Unstructured][]any)
+		o.now = time.Now().UTC()
+		if o.bootstrapUserData != "" {
+			content, err := readBootstrapUserData(o.bootstrapUserData)
+			if err != nil {
+				return err
+			}
+			o.userDataContent = content
+		}
+		files, err := readAirGapFiles(o.caBundle, o.registryMirrorConfig)
+		if err != nil {
+			return err
+		}
+		o.airGapFiles = files
+	}
+	// Every kind is recorded, so that validate checks the same kinds as
+	// validateKinds does with the kinds of the input.
+	o.isFound[ri.Object.GetKind()] = true
+	if o.userDataContent != "" {
+		found, err := setBootstrapUserData(ri, o.userDataContent)
+		if err != nil {
+			return err
+		}
+		o.foundUserDataCfg = o.foundUserDataCfg || found
+	}
+	if len(o.airGapFiles) > 0 && airGapConfigKinds[ri.Object.GetKind()] {
+		o.foundAirGapCfg = true
+		for _, f := range o.airGapFiles {
+			if err := addBootstrapFile(ri, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The sizes of the pools are recorded, so that pause only pauses the
+	// pools whose size the provider mutations change.
+	if o.pauseDuringScale && poolScalingPaths[ri.Object.GetKind()] != nil {
+		o.poolScaling[ri.Object] = scalingOf(ri.Object)
+	}
+
+	switch ri.Object.GetKind() {
+	case kubeadmControlPlaneKind, machineDeploymentKind:
+		if o.rolloutNow && !skipped(ri.Object, skipRollout) {
+			if err := setRolloutAfter(ri, o.now); err != nil {
+				return err
+			}
+		}
+		if ri.Object.GetKind() == kubeadmControlPlaneKind {
+			for k, v := range o.cpMachineLabels {
+				if err := setField(ri, v, "spec", "machineTemplate", "metadata", "labels", k); err != nil {
+					return err
+				}
+			}
+			for _, s := range o.apiServerArgs {
+				k, v, err := parseAPIServerArg(s)
+				if err != nil {
+					return err
+				}
+				if err := setField(ri, v, "spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraArgs", k); err != nil {
+					return err
+				}
+			}
+		}
+	case clusterKind:
+		o.isFound[clusterKind] = true
+		if o.bumpVersion {
+			if err := bumpTopologyVersion(ri); err != nil {
+				return err
+			}
+		}
+	case clusterResourceSetKind:
+		if err := setClusterResourceSet(ri, o.crsSelector, o.crsResources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pause adds the paused annotation to the pool of ri when --pause-during-scale
+// is set and its min or max size was changed since apply. It runs after the
+// provider mutations.
+//
+// Pausing is the first of two phases, the pools are unpaused by an external
+// step after the controllers settled on the new size.
+func (o *coreOptions) pause(ri parser.ResourceInfo) error {
+	before, ok := o.poolScaling[ri.Object]
+	if !ok || reflect.DeepEqual(before, scalingOf(ri.Object)) {
+		return nil
+	}
+	return setField(ri, "true", "metadata", "annotations", pausedAnnotation)
+}
+
+// scalingOf returns the min and max size of the pool obj.
+func scalingOf(obj *unstructured.Unstructured) []any {
+	paths := poolScalingPaths[obj.GetKind()]
+	values := make([]any, len(paths))
+	for i, path := range paths {
+		values[i], _, _ = unstructured.NestedFieldCopy(obj.UnstructuredContent(), path...)
+	}
+	return values
+}
+
+func (o *coreOptions) validate() error {
+	if o.bootstrapUserData != "" && !o.foundUserDataCfg {
+		return errors.New("failed to get a bootstrap config for the bootstrap user-data")
+	}
+	if (o.caBundle != "" || o.registryMirrorConfig != "") && !o.foundAirGapCfg {
+		return errors.New("failed to get KubeadmControlPlane or KubeadmConfigTemplate for the CA bundle and registry mirror config")
+	}
+	return o.validateKinds(o.isFound)
+}
+
+// validateFlags validates the flags that don't depend on the input. It runs
+// before any resource is processed, even with --stream.
+func (o *coreOptions) validateFlags() error {
+	if err := validateLabels(o.crsSelector); err != nil {
+		return err
+	}
+	if err := validateLabels(o.cpMachineLabels); err != nil {
+		return err
+	}
+	for _, r := range o.crsResources {
+		if _, _, err := parseCRSResource(r); err != nil {
+			return err
+		}
+	}
+	for _, s := range o.apiServerArgs {
+		if _, _, err := parseAPIServerArg(s); err != nil {
+			return err
+		}
+	}
+	if o.bootstrapUserData != "" {
+		if _, err := os.Stat(o.bootstrapUserData); err != nil {
+			return fmt.Errorf("failed to read bootstrap user-data: %w", err)
+		}
+	}
+	for _, path := range []string{o.caBundle, o.registryMirrorConfig} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// validateKinds validates the flags against the kinds found in the input.
+func (o *coreOptions) validateKinds(isFound map[string]bool) error {
+	if o.rolloutNow && !isFound[kubeadmControlPlaneKind] && !isFound[machineDeploymentKind] {
+		return errors.New("failed to get KubeadmControlPlane or MachineDeployment for rollout")
+	}
+	if o.bootstrapUserData != "" {
+		var found bool
+		for kind := range bootstrapConfigPaths {
+			found = found || isFound[kind]
+		}
+		if !found {
+			return errors.New("failed to get a bootstrap config for the bootstrap user-data")
+		}
+	}
+	if o.caBundle != "" || o.registryMirrorConfig != "" {
+		var found bool
+		for kind := range airGapConfigKinds {
+			found = found || isFound[kind]
+		}
+		if !found {
+			return errors.New("failed to get KubeadmControlPlane or KubeadmConfigTemplate for the CA bundle and registry mirror config")
+		}
+	}
+	if len(o.apiServerArgs) > 0 && !isFound[kubeadmControlPlaneKind] {
+		return errors.New("failed to get KubeadmControlPlane for API server arguments")
+	}
+	if len(o.cpMachineLabels) > 0 && !isFound[kubeadmControlPlaneKind] {
+		return errors.New("failed to get KubeadmControlPlane for machine template labels")
+	}
+	if o.bumpVersion && !isFound[clusterKind] {
+		return errors.New("failed to get Cluster for version bump")
+	}
+	if (len(o.crsSelector) > 0 || len(o.crsResources) > 0) && !isFound[clusterResourceSetKind] {
+		return errors.New("failed to get ClusterResourceSet for configuration")
+	}
+	return nil
+}
+
+func parseCRSResource(s string) (string, string, error) {
+	kind, name, ok := strings.Cut(s, "/")
+	if !ok || name == "" || (kind != "ConfigMap" && kind != "Secret") {
+		return "", "", fmt.Errorf("invalid ClusterResourceSet resource %q, expected ConfigMap/name or Secret/name", s)
+	}
+	return kind, name, nil
+}
+
+func parseAPIServerArg(s string) (string, string, error) {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || !apiServerArgKeyRegex.MatchString(k) {
+		return "", "", fmt.Errorf("invalid API server argument %q, expected key=value with a lowercase flag name as key", s)
+	}
+	return k, v, nil
+}
+
+func setClusterResourceSet(ri parser.ResourceInfo, selector map[string]string, resources []string) error {
+	for k, v := range selector {
+		if err := setField(ri, v, "spec", "clusterSelector", "matchLabels", k); err != nil {
+			return err
+		}
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+	refs := make([]interface{}, 0, len(resources))
+	for _, r := range resources {
+		kind, name, err := parseCRSResource(r)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, map[string]any{
+			"kind": kind,
+			"name": name,
+		})
+	}
+	return setField(ri, refs, "spec", "resources")
+}
+
+func setRolloutAfter(ri parser.ResourceInfo, t time.Time) error {
+	return setField(ri, t.Format(time.RFC3339), "spec", "rolloutAfter")
+}
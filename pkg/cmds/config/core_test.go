@@ -0,0 +1,237 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+const kubeadmConfigTemplateYAML = `apiVersion: bootstrap.cluster.x-k8s.io/v1beta1
+kind: KubeadmConfigTemplate
+metadata:
+  name: c1-md-0
+  namespace: default
+spec:
+  template:
+    spec:
+      joinConfiguration:
+        nodeRegistration:
+          name: '{{ ds.meta_data.local_hostname }}'
+`
+
+const machineDeploymentYAML = `apiVersion: cluster.x-k8s.io/v1beta1
+kind: MachineDeployment
+metadata:
+  name: c1-md-0
+  namespace: default
+spec:
+  clusterName: c1
+`
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestCoreValidateAfterMutation checks that validating after the mutations,
+// as done with --fail-fast=false, agrees with validating the input kinds
+// up front.
+func TestCoreValidateAfterMutation(t *testing.T) {
+	script := writeTempFile(t, "user-data.sh", "echo hello\n")
+	bundle := writeTempFile(t, "ca.crt", "-----BEGIN CERTIFICATE-----\n")
+
+	tests := []struct {
+		name    string
+		opts    coreOptions
+		in      string
+		wantErr bool
+	}{
+		{name: "user-data on KubeadmConfigTemplate", opts: coreOptions{bootstrapUserData: script}, in: kubeadmConfigTemplateYAML},
+		{name: "CA bundle on KubeadmConfigTemplate", opts: coreOptions{caBundle: bundle}, in: kubeadmConfigTemplateYAML},
+		{name: "registry mirror config on KubeadmConfigTemplate", opts: coreOptions{registryMirrorConfig: bundle}, in: kubeadmConfigTemplateYAML},
+		{name: "user-data without bootstrap config", opts: coreOptions{bootstrapUserData: script}, in: machineDeploymentYAML, wantErr: true},
+		{name: "CA bundle without bootstrap config", opts: coreOptions{caBundle: bundle}, in: machineDeploymentYAML, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := []byte(tt.in)
+			var ioOpts ioOptions
+			kinds, err := ioOpts.kinds(in, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.opts.validateKinds(kinds); (err != nil) != tt.wantErr {
+				t.Fatalf("validateKinds() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err := parser.ProcessResources(in, tt.opts.apply); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestPauseDuringScale checks that --pause-during-scale sets the scaling
+// fields and pauses only the pools whose min or max size changes.
+func TestPauseDuringScale(t *testing.T) {
+	in, err := os.ReadFile(filepath.Join("testdata", "eks.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// scaled has the sizes of the pools set to 1 and 3 already.
+	scaled, err := ConfigureCAPA(in, CAPAOptions{MinNodeCount: 1, MaxNodeCount: 3, Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		in         []byte
+		pause      bool
+		min, max   int64
+		wantPaused map[string]bool
+	}{
+		{
+			name: "both pools resized", in: in, pause: true, min: 2, max: 5,
+			wantPaused: map[string]bool{machinePoolKind: true, awsManagedMachinePoolKind: true},
+		},
+		{
+			name: "only the autoscaler annotations added", in: in, pause: true, min: 1, max: 3,
+			wantPaused: map[string]bool{machinePoolKind: true},
+		},
+		{
+			name: "sizes unchanged", in: scaled, pause: true, min: 1, max: 3,
+		},
+		{
+			name: "disabled", in: in, min: 2, max: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, err := configureCAPA(t, tt.in, CAPAOptions{
+				MinNodeCount: tt.min,
+				MaxNodeCount: tt.max,
+				coreOpts:     &coreOptions{pauseDuringScale: tt.pause},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mp := objs[awsManagedMachinePoolKind]
+			minSize, _, _ := unstructured.NestedInt64(mp.Object, "spec", "scaling", "minSize")
+			maxSize, _, _ := unstructured.NestedInt64(mp.Object, "spec", "scaling", "maxSize")
+			if minSize != tt.min || maxSize != tt.max {
+				t.Errorf("%s spec.scaling = %d/%d, want %d/%d", awsManagedMachinePoolKind, minSize, maxSize, tt.min, tt.max)
+			}
+			annotations := objs[machinePoolKind].GetAnnotations()
+			if got, want := annotations[autoscalerMinSizeAnnotation]+"/"+annotations[autoscalerMaxSizeAnnotation], fmt.Sprintf("%d/%d", tt.min, tt.max); got != want {
+				t.Errorf("%s autoscaler sizes = %s, want %s", machinePoolKind, got, want)
+			}
+
+			for kind, obj := range objs {
+				_, paused := obj.GetAnnotations()[pausedAnnotation]
+				if paused != tt.wantPaused[kind] {
+					t.Errorf("%s paused = %v, want %v", kind, paused, tt.wantPaused[kind])
+				}
+			}
+		})
+	}
+}
+
+// TestBootstrapUserDataTwice checks that running the command again on its
+// own output replaces the user-data file instead of adding a second one.
+func TestBootstrapUserDataTwice(t *testing.T) {
+	out := []byte(kubeadmConfigTemplateYAML)
+	for _, content := range []string{"echo hello\n", "echo bye\n"} {
+		coreOpts := coreOptions{bootstrapUserData: writeTempFile(t, "user-data.sh", content)}
+		ioOpts := ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing}
+		var err error
+		if out, err = ioOpts.processResources(out, coreOpts.apply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := parser.ProcessResources(out, func(ri parser.ResourceInfo) error {
+		files, _, err := unstructured.NestedSlice(ri.Object.Object, "spec", "template", "spec", "files")
+		if err != nil {
+			return err
+		}
+		if len(files) != 1 {
+			t.Fatalf("files = %v, want a single user-data file", files)
+		}
+		want := base64.StdEncoding.EncodeToString([]byte("echo bye\n"))
+		if got := files[0].(map[string]any)["content"]; got != want {
+			t.Errorf("user-data content = %v, want the content of the last run %q", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAirGapFilesTwice checks that running the command again on its own
+// output adds neither the air-gap files nor their commands twice.
+func TestAirGapFilesTwice(t *testing.T) {
+	coreOpts := coreOptions{
+		caBundle:             writeTempFile(t, "ca.crt", "-----BEGIN CERTIFICATE-----\n"),
+		registryMirrorConfig: writeTempFile(t, "config.toml", "version = 2\n"),
+		bootstrapUserData:    writeTempFile(t, "user-data.sh", "echo hello\n"),
+	}
+	out := []byte(kubeadmConfigTemplateYAML)
+	for i := 0; i < 2; i++ {
+		coreOpts.reset()
+		ioOpts := ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing}
+		var err error
+		if out, err = ioOpts.processResources(out, coreOpts.apply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := parser.ProcessResources(out, func(ri parser.ResourceInfo) error {
+		spec, _, err := unstructured.NestedMap(ri.Object.Object, "spec", "template", "spec")
+		if err != nil {
+			return err
+		}
+		if files, _ := spec["files"].([]any); len(files) != 3 {
+			t.Errorf("files = %v, want 3", files)
+		}
+		want := []any{bootstrapUserDataPath, "update-ca-certificates", "systemctl restart containerd"}
+		if got := spec["preKubeadmCommands"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("preKubeadmCommands = %v, want %v", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestReadInputCRLF(t *testing.T) {
+	f, err := os.Open("testdata/crlf.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	o := ioOptions{trailingNewline: true, preserveLineEndings: true}
+	in, err := o.readInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(in, []byte("\r")) {
+		t.Errorf("readInput() kept CR characters: %q", in)
+	}
+	if !o.crlf {
+		t.Error("readInput() did not record CRLF input")
+	}
+
+	var kinds []string
+	err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		kinds = append(kinds, ri.Object.GetKind()+"/"+ri.Object.GetName())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kinds) != 2 || kinds[0] != "Cluster/capi" || kinds[1] != "MachinePool/capi-pool-0" {
+		t.Errorf("resources = %v, want [Cluster/capi MachinePool/capi-pool-0]", kinds)
+	}
+
+	out := captureStdout(t, func() error {
+		return o.write([]byte("kind: Cluster\nmetadata:\n  name: capi\n"))
+	})
+	if want := "kind: Cluster\r\nmetadata:\r\n  name: capi\r\n"; string(out) != want {
+		t.Errorf("write() = %q, want %q", out, want)
+	}
+
+	o.preserveLineEndings = false
+	out = captureStdout(t, func() error {
+		return o.write([]byte("kind: Cluster\n"))
+	})
+	if want := "kind: Cluster\n"; string(out) != want {
+		t.Errorf("write() without --preserve-line-endings = %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// knownDefaults lists, per kind, fields whose value equals the default set by
+// the CRD schema or the provider webhooks, keyed by dotted path. Only fields
+// with a well known default belong here, since pruning a field whose default
+// differs changes the meaning of the manifest.
+var knownDefaults = map[string]map[string]any{
+	machineDeploymentKind: {
+		"spec.minReadySeconds":         int64(0),
+		"spec.revisionHistoryLimit":    int64(1),
+		"spec.progressDeadlineSeconds": int64(600),
+	},
+	machinePoolKind: {
+		"spec.minReadySeconds": int64(0),
+	},
+	kubeadmControlPlaneKind: {
+		"spec.rolloutStrategy.type":                   "RollingUpdate",
+		"spec.rolloutStrategy.rollingUpdate.maxSurge": int64(1),
+	},
+	awsClusterKind: {
+		"spec.controlPlaneLoadBalancer.scheme":           "internet-facing",
+		"spec.controlPlaneLoadBalancer.loadBalancerType": "classic",
+		"spec.network.vpc.availabilityZoneUsageLimit":    int64(3),
+		"spec.network.vpc.availabilityZoneSelection":     "Ordered",
+	},
+	awsManagedControlPlaneKind: {
+		"spec.associateOIDCProvider":                  false,
+		"spec.network.vpc.availabilityZoneUsageLimit": int64(3),
+		"spec.network.vpc.availabilityZoneSelection":  "Ordered",
+	},
+	awsManagedMachinePoolKind: {
+		"spec.capacityType": "onDemand",
+	},
+}
+
+// flagDefaultFields lists, per flag, the fields of knownDefaults the flag
+// sets, by kind. A value given explicitly is kept even if it equals the
+// default, e.g. --lb-scheme internet-facing.
+var flagDefaultFields = map[string]map[string][]string{
+	"az-usage-limit": {
+		awsManagedControlPlaneKind: {"spec.network.vpc.availabilityZoneUsageLimit"},
+	},
+	"lb-scheme": {
+		awsClusterKind: {"spec.controlPlaneLoadBalancer.scheme"},
+	},
+	"lb-type": {
+		awsClusterKind: {"spec.controlPlaneLoadBalancer.loadBalancerType"},
+	},
+}
+
+// keepFlagDefaults records the fields set by the flags of fs changed in this
+// run, so that --prune-defaults doesn't remove them.
+func (o *transformOptions) keepFlagDefaults(fs *pflag.FlagSet) {
+	o.keepDefaults = make(map[string]map[string]bool)
+	for name, kinds := range flagDefaultFields {
+		if !fs.Changed(name) {
+			continue
+		}
+		for kind, paths := range kinds {
+			if o.keepDefaults[kind] == nil {
+				o.keepDefaults[kind] = make(map[string]bool)
+			}
+			for _, path := range paths {
+				o.keepDefaults[kind][path] = true
+			}
+		}
+	}
+}
+
+// pruneDefaults removes the fields of obj that are set to their known
+// default, except for the fields in keep by kind. Maps left empty by the
+// removal are removed as well.
+func pruneDefaults(obj *unstructured.Unstructured, keep map[string]map[string]bool) {
+	for path, def := range knownDefaults[obj.GetKind()] {
+		if keep[obj.GetKind()][path] {
+			continue
+		}
+		fields := strings.Split(path, ".")
+		v, ok, err := unstructured.NestedFieldNoCopy(obj.Object, fields...)
+		if err != nil || !ok || !reflect.DeepEqual(v, def) {
+			continue
+		}
+		unstructured.RemoveNestedField(obj.Object, fields...)
+		for i := len(fields) - 1; i > 0; i-- {
+			parent, ok, _ := unstructured.NestedMap(obj.Object, fields[:i]...)
+			if !ok || len(parent) > 0 {
+				break
+			}
+			unstructured.RemoveNestedField(obj.Object, fields[:i]...)
+		}
+	}
+}
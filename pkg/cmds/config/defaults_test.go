@@ -0,0 +1,156 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestPruneDefaults(t *testing.T) {
+	for kind, defaults := range knownDefaults {
+		t.Run(kind, func(t *testing.T) {
+			pruned := &unstructured.Unstructured{}
+			pruned.SetKind(kind)
+			pruned.SetName("default")
+			kept := pruned.DeepCopy()
+			for path, def := range defaults {
+				fields := strings.Split(path, ".")
+				if err := unstructured.SetNestedField(pruned.Object, def, fields...); err != nil {
+					t.Fatal(err)
+				}
+				if err := unstructured.SetNestedField(kept.Object, nonDefault(def), fields...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := kept.DeepCopy()
+
+			pruneDefaults(pruned, nil)
+			if _, ok := pruned.Object["spec"]; ok {
+				t.Errorf("defaults left in spec: %v", pruned.Object["spec"])
+			}
+			if pruned.GetName() != "default" {
+				t.Errorf("metadata was pruned: %v", pruned.Object["metadata"])
+			}
+
+			pruneDefaults(kept, nil)
+			if !reflect.DeepEqual(kept.Object, want.Object) {
+				t.Errorf("non-default values were pruned: got %v, want %v", kept.Object, want.Object)
+			}
+		})
+	}
+}
+
+func TestPruneDefaultsUnknownKind(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetKind(clusterKind)
+	if err := unstructured.SetNestedField(obj.Object, int64(0), "spec", "minReadySeconds"); err != nil {
+		t.Fatal(err)
+	}
+	pruneDefaults(obj, nil)
+	if _, ok, _ := unstructured.NestedInt64(obj.Object, "spec", "minReadySeconds"); !ok {
+		t.Error("field of an unrecognized kind was pruned")
+	}
+}
+
+// TestPruneDefaultsKeepsFlags checks that --prune-defaults keeps the
+// defaults set explicitly by flags, and prunes them otherwise.
+func TestPruneDefaultsKeepsFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want map[string]any
+	}{
+		{
+			name: "flags given",
+			args: []string{"--az-usage-limit=3", "--lb-scheme=internet-facing"},
+			want: map[string]any{
+				awsManagedControlPlaneKind + ":spec.network.vpc.availabilityZoneUsageLimit": int64(3),
+				awsClusterKind + ":spec.controlPlaneLoadBalancer.scheme":                    "internet-facing",
+			},
+		},
+		{
+			name: "flags not given",
+			want: map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			in := filepath.Join(dir, "in.yaml")
+			manifest := capaManifestYAML + `---
+apiVersion: infrastructure.cluster.x-k8s.io/v1beta2
+kind: AWSCluster
+metadata:
+  name: capi-lb
+  namespace: default
+spec:
+  controlPlaneLoadBalancer:
+    scheme: internet-facing
+`
+			if err := os.WriteFile(in, []byte(manifest), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			out := filepath.Join(dir, "out.yaml")
+
+			cmd := NewCmdCAPA()
+			cmd.SetArgs(append([]string{"-f", in, "-o", out, "--quiet", "--prune-defaults"}, tt.args...))
+			cmd.SilenceUsage = true
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]any{}
+			err = parser.ProcessResources(data, func(ri parser.ResourceInfo) error {
+				for path := range knownDefaults[ri.Object.GetKind()] {
+					if v, ok, _ := unstructured.NestedFieldCopy(ri.Object.Object, strings.Split(path, ".")...); ok {
+						got[ri.Object.GetKind()+":"+path] = v
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("defaults in the output = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func nonDefault(v any) any {
+	switch v := v.(type) {
+	case int64:
+		return v + 1
+	case bool:
+		return !v
+	case string:
+		return v + "-custom"
+	}
+	return v
+}
@@ -0,0 +1,55 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// runDir calls fn for every .yaml and .yml file below --dir in lexical
+// order, with the file as input and output, so that every file is
+// validated and rewritten on its own. It stops at the first failing file.
+func (o *ioOptions) runDir(fn func() error) error {
+	if o.dir == "" || !o.inPlace {
+		return errors.New("--dir and --in-place must be used together")
+	}
+	if len(o.files) > 0 || o.tar != "" || o.watch || o.stream {
+		return errors.New("--dir can't be used with --file, --tar, --watch or --stream")
+	}
+	if o.output != "" || o.tarOutput != "" || o.push != "" {
+		return errors.New("--in-place can't be used with --output, --tar-output or --push")
+	}
+	defer func() {
+		o.files, o.output = nil, ""
+	}()
+	return filepath.WalkDir(o.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		o.files, o.output = []string{path}, path
+		if err := fn(); err != nil {
+			return fmt.Errorf("failed to process %s: %w", path, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// fieldModeCreateIfMissing lets the setter helpers create missing parent
+	// fields of the fields they set.
+	fieldModeCreateIfMissing = "create-if-missing"
+	// fieldModePatchIfExists only keeps changes to fields whose parent
+	// already exists in the input. Parents created by the setter helpers are
+	// dropped again.
+	fieldModePatchIfExists = "patch-if-exists"
+)
+
+func validateFieldMode(mode string) error {
+	switch mode {
+	case fieldModeCreateIfMissing, fieldModePatchIfExists:
+		return nil
+	}
+	return fmt.Errorf("unsupported field mode %q, expected %s or %s", mode, fieldModeCreateIfMissing, fieldModePatchIfExists)
+}
+
+// dropCreatedParents removes the fields of cur that were created along with
+// a missing parent, compared to orig. New fields are kept when their parent
+// map already exists in orig, so only whole new maps are removed.
+func dropCreatedParents(orig, cur map[string]any, path []string, kind, name string, w *warnings) {
+	for k, v := range cur {
+		fieldPath := append(append([]string{}, path...), k)
+		ov, ok := orig[k]
+		if !ok {
+			if m, isMap := v.(map[string]any); isMap && len(m) > 0 {
+				w.add("%s/%s: skipping changes under %s, it doesn't exist in the input", kind, name, strings.Join(fieldPath, "."))
+				delete(cur, k)
+			}
+			continue
+		}
+		om, ok := ov.(map[string]any)
+		if !ok {
+			continue
+		}
+		if m, ok := v.(map[string]any); ok {
+			dropCreatedParents(om, m, fieldPath, kind, name, w)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestSetMPConfigurationGenerateName(t *testing.T) {
+	in, err := os.ReadFile("testdata/generate-name.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w warnings
+	var pools []parser.ResourceInfo
+	err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if err := SetMPConfiguration(ri, "default", 1, 3, &w); err != nil {
+			return err
+		}
+		pools = append(pools, ri)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("got %d pools, want 2", len(pools))
+	}
+	if len(w.msgs) != 1 {
+		t.Errorf("warnings = %q, want one for the skipped rename", w.msgs)
+	}
+
+	tests := []struct {
+		name             string
+		ri               parser.ResourceInfo
+		wantName         string
+		wantGenerateName string
+		wantResourceName string
+	}{
+		{
+			name:             "generateName is kept",
+			ri:               pools[0],
+			wantGenerateName: "capi-pool-",
+			wantResourceName: "capi-pool",
+		},
+		{
+			name:             "name is replaced",
+			ri:               pools[1],
+			wantName:         "default",
+			wantResourceName: "default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ri.Object.GetName(); got != tt.wantName {
+				t.Errorf("name = %q, want %q", got, tt.wantName)
+			}
+			if got := tt.ri.Object.GetGenerateName(); got != tt.wantGenerateName {
+				t.Errorf("generateName = %q, want %q", got, tt.wantGenerateName)
+			}
+			if got := resourceName(tt.ri); got != tt.wantResourceName {
+				t.Errorf("resourceName() = %q, want %q", got, tt.wantResourceName)
+			}
+			ref, _, _ := unstructured.NestedString(tt.ri.Object.Object, "spec", "template", "spec", "infrastructureRef", "name")
+			if ref != "default" {
+				t.Errorf("infrastructureRef name = %q, want %q", ref, "default")
+			}
+			if got := tt.ri.Object.GetAnnotations()["cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"]; got != "3" {
+				t.Errorf("max size annotation = %q, want %q", got, "3")
+			}
+		})
+	}
+}
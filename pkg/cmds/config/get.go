@@ -0,0 +1,102 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+const getOutputFormatText = "text"
+
+func NewCmdGet() *cobra.Command {
+	var path, outputFormat string
+	var strict bool
+	cmd := &cobra.Command{
+		Use:               "get",
+		Short:             "Print a field of the resources of a kind",
+		Long:              "Print the value of the --path field of every resource of its kind read from stdin, one per line, or as a JSON array with --output-format=json",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if outputFormat != getOutputFormatText && outputFormat != outputFormatJSON {
+				return fmt.Errorf("invalid output format %q, expected text or json", outputFormat)
+			}
+			ref, err := parseFieldRef(path)
+			if err != nil {
+				return err
+			}
+			in, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			values, err := getFieldValues(in, ref)
+			if err != nil {
+				return err
+			}
+			if len(values) == 0 && strict {
+				return fmt.Errorf("failed to get %s", ref)
+			}
+			if outputFormat == outputFormatJSON {
+				if values == nil {
+					values = []any{}
+				}
+				data, err := json.MarshalIndent(values, "", "  ")
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", data)
+				return err
+			}
+			for _, v := range values {
+				if _, err := fmt.Fprintln(os.Stdout, fieldString(v)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&path, "path", "", "Field to print, in Kind:dotted.path format")
+	cmd.Flags().StringVar(&outputFormat, "output-format", getOutputFormatText, "Output format, text for one value per line or json for a JSON array")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail if no resource has the field")
+	return cmd
+}
+
+// getFieldValues returns the values of the field ref of the resources of
+// in, in input order. Resources without the field are left out.
+func getFieldValues(in []byte, ref fieldRef) ([]any, error) {
+	var values []any
+	err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if ri.Object.GetKind() != ref.kind {
+			return nil
+		}
+		v, found, err := unstructured.NestedFieldNoCopy(ri.Object.UnstructuredContent(), ref.path...)
+		if err != nil {
+			return fmt.Errorf("failed to get %s of %s/%s: %w", ref, ri.Object.GetKind(), ri.Object.GetName(), err)
+		}
+		if found {
+			values = append(values, v)
+		}
+		return nil
+	})
+	return values, err
+}
@@ -0,0 +1,51 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// outputGroup returns the group of obj used by --group-output, its API
+// group, which identifies the provider, and kind. The core API group is
+// named core.
+func outputGroup(obj *unstructured.Unstructured) string {
+	group := obj.GroupVersionKind().Group
+	if group == "" {
+		group = "core"
+	}
+	return group + "/" + obj.GetKind()
+}
+
+// groupObjects returns objs sorted by their output group, keeping the input
+// order within a group.
+func groupObjects(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+	sorted := append([]*unstructured.Unstructured{}, objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return outputGroup(sorted[i]) < outputGroup(sorted[j])
+	})
+	return sorted
+}
+
+// groupBanner returns the comment emitted before the first object of an
+// output group.
+func groupBanner(group string) string {
+	return fmt.Sprintf("# ---- %s ----\n", group)
+}
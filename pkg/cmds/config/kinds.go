@@ -0,0 +1,98 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// kindAliases maps short names accepted in Kind selectors to the kinds
+// they stand for.
+var kindAliases = map[string]string{
+	"cl":     clusterKind,
+	"mp":     machinePoolKind,
+	"md":     machineDeploymentKind,
+	"kcp":    kubeadmControlPlaneKind,
+	"kct":    "KubeadmConfigTemplate",
+	"crs":    clusterResourceSetKind,
+	"amcp":   awsManagedControlPlaneKind,
+	"ammp":   awsManagedMachinePoolKind,
+	"awsc":   "AWSCluster",
+	"awsmt":  "AWSMachineTemplate",
+	"azmcp":  "AzureManagedControlPlane",
+	"azmmp":  "AzureManagedMachinePool",
+	"gcpmcp": "GCPManagedControlPlane",
+	"gcpmmp": "GCPManagedMachinePool",
+	"kvc":    "KubevirtCluster",
+	"kvmt":   "KubevirtMachineTemplate",
+}
+
+// resolveKind returns the kind for a Kind selector. Kinds are CamelCase, so
+// an all lowercase selector is treated as an alias and must be known.
+func resolveKind(s string) (string, error) {
+	if kind, ok := kindAliases[strings.ToLower(s)]; ok {
+		return kind, nil
+	}
+	for _, kind := range kindAliases {
+		if strings.EqualFold(kind, s) {
+			return kind, nil
+		}
+	}
+	if s == "" || !unicode.IsUpper(rune(s[0])) {
+		return "", fmt.Errorf("unknown kind alias %q, did you mean %q?", s, suggestAlias(s))
+	}
+	return s, nil
+}
+
+func suggestAlias(s string) string {
+	aliases := make([]string, 0, len(kindAliases))
+	for alias := range kindAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	best, bestDist := "", -1
+	for _, alias := range aliases {
+		if d := editDistance(strings.ToLower(s), alias); bestDist < 0 || d < bestDist {
+			best, bestDist = alias, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,93 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+func NewCmdValidateKubeconfig() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "validate-kubeconfig",
+		Short:             "Validate the kubeconfig Secret of a cluster",
+		Long:              "Validate the <cluster>-kubeconfig Secret created by Cluster API, read from stdin, and print the server of its current context",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			server, context, err := validateKubeconfigSecret(in)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(os.Stdout, "context: %s\nserver: %s\n", context, server)
+			return err
+		},
+	}
+	return cmd
+}
+
+// validateKubeconfigSecret decodes the kubeconfig stored in data.value of
+// the Secret manifest in and returns the server and name of its current
+// context.
+func validateKubeconfigSecret(in []byte) (string, string, error) {
+	var obj unstructured.Unstructured
+	if err := yaml.Unmarshal(in, &obj.Object); err != nil {
+		return "", "", fmt.Errorf("failed to parse Secret: %w", err)
+	}
+	if obj.GetKind() != "Secret" {
+		return "", "", fmt.Errorf("expected a Secret, found kind %q", obj.GetKind())
+	}
+	value, ok, err := unstructured.NestedString(obj.Object, "data", "value")
+	if err != nil {
+		return "", "", fmt.Errorf("invalid data.value of Secret %s: %w", obj.GetName(), err)
+	}
+	if !ok {
+		return "", "", fmt.Errorf("no data.value in Secret %s", obj.GetName())
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode data.value of Secret %s: %w", obj.GetName(), err)
+	}
+
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid kubeconfig in Secret %s: %w", obj.GetName(), err)
+	}
+	if err := clientcmd.Validate(*config); err != nil {
+		return "", "", fmt.Errorf("invalid kubeconfig in Secret %s: %w", obj.GetName(), err)
+	}
+	kctx, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return "", "", errors.New("kubeconfig has no current context")
+	}
+	cluster, ok := config.Clusters[kctx.Cluster]
+	if !ok {
+		return "", "", fmt.Errorf("kubeconfig has no cluster %q", kctx.Cluster)
+	}
+	return cluster.Server, config.CurrentContext, nil
+}
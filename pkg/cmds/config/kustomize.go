@@ -0,0 +1,148 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	kustomizePluginAPIVersion = "capi-config.klusters.dev/v1alpha1"
+	kustomizePluginKind       = "CAPIConfigTransformer"
+)
+
+// kustomizePluginProviders are the commands a kustomize plugin config can
+// run.
+var kustomizePluginProviders = map[string]func() *cobra.Command{
+	"capa": NewCmdCAPA,
+	"capg": NewCmdCAPG,
+	"capk": NewCmdCAPK,
+	"capz": NewCmdCAPZ,
+}
+
+// kustomizePluginUnsupportedFlags are the flags that conflict with the
+// plugin contract, where the resources are read from stdin and written to
+// stdout.
+var kustomizePluginUnsupportedFlags = map[string]bool{
+	"file":       true,
+	"watch":      true,
+	"tar":        true,
+	"tar-output": true,
+	"output":     true,
+	"push":       true,
+	"dir":        true,
+	"in-place":   true,
+}
+
+// kustomizePluginConfig is the config object of the kustomize exec plugin.
+// Args holds the flags of the provider command by name, env its
+// environment variables.
+type kustomizePluginConfig struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   map[string]any    `json:"metadata,omitempty"`
+	Provider   string            `json:"provider"`
+	Args       map[string]any    `json:"args,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+}
+
+func NewCmdKustomizePlugin() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kustomize-plugin CONFIG",
+		Short: "Run as a kustomize exec transformer plugin",
+		Long: "Run as a kustomize exec transformer plugin. The resources are read from stdin and the transformed resources written to stdout. " +
+			"CONFIG is the path of the " + kustomizePluginKind + " config object passed by kustomize, selecting the provider command and its flags and environment variables.",
+		Args:              cobra.ExactArgs(1),
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read plugin config: %w", err)
+			}
+			provider, err := newKustomizePluginCommand(data)
+			if err != nil {
+				return err
+			}
+			return provider.RunE(provider, nil)
+		},
+	}
+	return cmd
+}
+
+// newKustomizePluginCommand returns the provider command of the plugin
+// config data, with its flags and environment variables set.
+func newKustomizePluginCommand(data []byte) (*cobra.Command, error) {
+	var cfg kustomizePluginConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid plugin config: %w", err)
+	}
+	if cfg.APIVersion != kustomizePluginAPIVersion || cfg.Kind != kustomizePluginKind {
+		return nil, fmt.Errorf("invalid plugin config %s/%s, expected %s/%s", cfg.APIVersion, cfg.Kind, kustomizePluginAPIVersion, kustomizePluginKind)
+	}
+	newCmd, ok := kustomizePluginProviders[cfg.Provider]
+	if !ok {
+		providers := make([]string, 0, len(kustomizePluginProviders))
+		for p := range kustomizePluginProviders {
+			providers = append(providers, p)
+		}
+		sort.Strings(providers)
+		return nil, fmt.Errorf("invalid plugin config provider %q, expected one of %s", cfg.Provider, strings.Join(providers, ", "))
+	}
+
+	cmd := newCmd()
+	names := make([]string, 0, len(cfg.Args))
+	for name := range cfg.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if kustomizePluginUnsupportedFlags[name] {
+			return nil, fmt.Errorf("invalid plugin config: args.%s is not supported in a kustomize plugin", name)
+		}
+		if cmd.Flags().Lookup(name) == nil {
+			return nil, fmt.Errorf("invalid plugin config: unknown field args.%s for provider %s", name, cfg.Provider)
+		}
+		values, ok := cfg.Args[name].([]any)
+		if !ok {
+			values = []any{cfg.Args[name]}
+		}
+		for _, v := range values {
+			if _, ok := v.(map[string]any); ok || v == nil {
+				return nil, fmt.Errorf("invalid plugin config: args.%s must be a scalar or a list of scalars", name)
+			}
+			if err := cmd.Flags().Set(name, fmt.Sprint(v)); err != nil {
+				return nil, fmt.Errorf("invalid plugin config: args.%s: %w", name, err)
+			}
+		}
+	}
+	for k, v := range cfg.Env {
+		if k == "" {
+			return nil, errors.New("invalid plugin config: env name is empty")
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+type liveClient struct {
+	dc     dynamic.Interface
+	mapper meta.RESTMapper
+}
+
+func newLiveClient(kubeconfig string) (*liveClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	dc, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &liveClient{
+		dc:     dc,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disco)),
+	}, nil
+}
+
+// rebase replaces the content of obj with its live copy from the cluster,
+// so that mutations are applied on top of server-managed fields. Objects
+// that don't exist in the cluster yet are left untouched, like objects with
+// only a generateName, whose name is picked by the server on create.
+func (c *liveClient) rebase(obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	if obj.GetName() == "" {
+		klog.V(3).Infof("%s has no name, using input %s with generateName %q", gvk, gvk.Kind, obj.GetGenerateName())
+		return nil
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		klog.V(3).Infof("%s is not served by the cluster, using input %s/%s", gvk, gvk.Kind, obj.GetName())
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var ri dynamic.ResourceInterface = c.dc.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		ns := obj.GetNamespace()
+		if ns == "" {
+			ns = metav1.NamespaceDefault
+		}
+		ri = c.dc.Resource(mapping.Resource).Namespace(ns)
+	}
+	live, err := ri.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		klog.V(3).Infof("%s/%s not found in cluster, using input", gvk.Kind, obj.GetName())
+		return nil
+	} else if err != nil {
+		return err
+	}
+	live.SetManagedFields(nil)
+	obj.Object = live.Object
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const liveMachinePoolJSON = `{
+  "apiVersion": "cluster.x-k8s.io/v1beta1",
+  "kind": "MachinePool",
+  "metadata": {"name": "capi-pool-0", "namespace": "default", "uid": "1234"},
+  "spec": {"clusterName": "capi", "replicas": 3}
+}`
+
+// newTestLiveClient returns a liveClient for a fake API server serving the
+// live MachinePool capi-pool-0, and the paths of the requests it received.
+func newTestLiveClient(t *testing.T) (*liveClient, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/apis/cluster.x-k8s.io/v1beta1/namespaces/default/machinepools/capi-pool-0" {
+			_, _ = w.Write([]byte(liveMachinePoolJSON))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	dc, err := dynamic.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gv := schema.GroupVersion{Group: "cluster.x-k8s.io", Version: "v1beta1"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{gv})
+	mapper.Add(gv.WithKind(machinePoolKind), meta.RESTScopeNamespace)
+	return &liveClient{dc: dc, mapper: mapper}, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+func TestLiveRebase(t *testing.T) {
+	tests := []struct {
+		name         string
+		objName      string
+		generateName string
+		wantRequest  bool
+		wantReplicas int64 // 0 if the input is kept
+	}{
+		{name: "live object", objName: "capi-pool-0", wantRequest: true, wantReplicas: 3},
+		{name: "not in the cluster", objName: "capi-pool-1", wantRequest: true},
+		{name: "generateName only", generateName: "capi-pool-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, requests := newTestLiveClient(t)
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion("cluster.x-k8s.io/v1beta1")
+			obj.SetKind(machinePoolKind)
+			obj.SetNamespace("default")
+			obj.SetName(tt.objName)
+			obj.SetGenerateName(tt.generateName)
+
+			if err := c.rebase(obj); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(requests()) > 0; got != tt.wantRequest {
+				t.Errorf("requests = %v, want a request %v", requests(), tt.wantRequest)
+			}
+			replicas, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+			if replicas != tt.wantReplicas {
+				t.Errorf("spec.replicas = %d, want %d", replicas, tt.wantReplicas)
+			}
+			if obj.GetGenerateName() != tt.generateName {
+				t.Errorf("generateName = %q, want %q", obj.GetGenerateName(), tt.generateName)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// clusterctlMoveLabel makes clusterctl move pick up resources that are not
+// linked to a Cluster through owner references.
+const clusterctlMoveLabel = "clusterctl.cluster.x-k8s.io/move"
+
+// moveObject identifies a resource of the manifest by kind, namespace and
+// name.
+type moveObject struct {
+	kind, namespace, name string
+}
+
+func (m moveObject) String() string {
+	if m.namespace == "" {
+		return m.kind + "/" + m.name
+	}
+	return m.kind + "/" + m.namespace + "/" + m.name
+}
+
+// moveRef is a reference of a Cluster to another resource.
+type moveRef struct {
+	from, to moveObject
+}
+
+// prepareMove strips the status of obj and labels it for clusterctl move,
+// unless it is a Cluster API kind, which clusterctl discovers on its own.
+func prepareMove(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	gv, _ := schema.ParseGroupVersion(obj.GetAPIVersion())
+	if !strings.HasSuffix(gv.Group, "cluster.x-k8s.io") {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[clusterctlMoveLabel] = ""
+		obj.SetLabels(labels)
+	}
+}
+
+// moveRefs returns the references of a Cluster, so that the caller can check
+// that the manifest is self-contained.
+func moveRefs(obj *unstructured.Unstructured) []moveRef {
+	if obj.GetKind() != clusterKind {
+		return nil
+	}
+	var refs []moveRef
+	for _, field := range []string{"infrastructureRef", "controlPlaneRef"} {
+		ref, ok, _ := unstructured.NestedStringMap(obj.Object, "spec", field)
+		if !ok || ref["kind"] == "" || ref["name"] == "" {
+			continue
+		}
+		ns := ref["namespace"]
+		if ns == "" {
+			ns = obj.GetNamespace()
+		}
+		refs = append(refs, moveRef{
+			from: moveObject{kind: obj.GetKind(), namespace: obj.GetNamespace(), name: obj.GetName()},
+			to:   moveObject{kind: ref["kind"], namespace: ns, name: ref["name"]},
+		})
+	}
+	return refs
+}
+
+// validateMoveSet checks that every reference of a Cluster points to a
+// resource of the manifest, so that the moved set is self-consistent.
+func validateMoveSet(objects map[moveObject]bool, refs []moveRef) error {
+	for _, ref := range refs {
+		if !objects[ref.to] {
+			return fmt.Errorf("%s references %s, which is not part of the manifest to move", ref.from, ref.to)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func() error) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	err = fn()
+	_ = w.Close()
+	data := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWriteTrailingNewline(t *testing.T) {
+	tests := []struct {
+		name            string
+		trailingNewline bool
+		in              string
+		want            string
+	}{
+		{name: "added", trailingNewline: true, in: "kind: Cluster", want: "kind: Cluster\n"},
+		{name: "kept", trailingNewline: true, in: "kind: Cluster\n", want: "kind: Cluster\n"},
+		{name: "collapsed", trailingNewline: true, in: "kind: Cluster\n\n\n", want: "kind: Cluster\n"},
+		{name: "removed", trailingNewline: false, in: "kind: Cluster\n", want: "kind: Cluster"},
+		{name: "empty", trailingNewline: true, in: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := ioOptions{trailingNewline: tt.trailingNewline}
+			got := captureStdout(t, func() error {
+				return o.write([]byte(tt.in))
+			})
+			if string(got) != tt.want {
+				t.Errorf("write() = %q, want %q", got, tt.want)
+			}
+			if len(got) > 0 && (got[len(got)-1] == '\n') != tt.trailingNewline {
+				t.Errorf("final byte = %q, trailingNewline %v", got[len(got)-1], tt.trailingNewline)
+			}
+		})
+	}
+}
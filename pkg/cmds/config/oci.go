@@ -0,0 +1,88 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+const (
+	ociArtifactType      = "application/vnd.klusters.capi-config.manifest"
+	ociManifestMediaType = "application/vnd.klusters.capi-config.manifest.layer.v1+yaml"
+	ociManifestTitle     = "manifest.yaml"
+)
+
+// pushOCI packages data as a single layer OCI artifact and pushes it to
+// ref, given as oci://registry/repo:tag. Registry credentials are read from
+// the docker config.
+func pushOCI(ctx context.Context, ref string, data []byte) error {
+	if !strings.HasPrefix(ref, "oci://") {
+		return fmt.Errorf("invalid push reference %q, expected oci://registry/repo:tag", ref)
+	}
+	repo, err := remote.NewRepository(strings.TrimPrefix(ref, "oci://"))
+	if err != nil {
+		return err
+	}
+	tag := repo.Reference.Reference
+	if tag == "" {
+		return fmt.Errorf("invalid push reference %q, tag is missing", ref)
+	}
+
+	store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return err
+	}
+	repo.Client = &auth.Client{
+		Client:     retry.DefaultClient,
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(store),
+	}
+
+	mem := memory.New()
+	layer := content.NewDescriptorFromBytes(ociManifestMediaType, data)
+	layer.Annotations = map[string]string{
+		ocispec.AnnotationTitle: ociManifestTitle,
+	}
+	if err := mem.Push(ctx, layer, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	desc, err := oras.PackManifest(ctx, mem, oras.PackManifestVersion1_1, ociArtifactType, oras.PackManifestOptions{
+		Layers: []ocispec.Descriptor{layer},
+	})
+	if err != nil {
+		return err
+	}
+	if err := mem.Tag(ctx, desc, tag); err != nil {
+		return err
+	}
+	if _, err := oras.Copy(ctx, mem, tag, repo, tag, oras.DefaultCopyOptions); err != nil {
+		return fmt.Errorf("failed to push %s: %w", ref, err)
+	}
+	return nil
+}
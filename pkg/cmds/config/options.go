@@ -0,0 +1,463 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+	"sigs.k8s.io/yaml"
+)
+
+var errNoInput = errors.New("no input resources provided")
+
+// ioOptions holds the input/output flags shared by all config commands.
+type ioOptions struct {
+	preserveBlockScalars bool
+	baseFromCluster      bool
+	kubeconfig           string
+	schema               string
+	trailingNewline      bool
+	normalizeStyle       bool
+	preserveLineEndings  bool
+	push                 string
+	printConfig          bool
+	asserts              []string
+	outputFormat         string
+	fieldMode            string
+	tar                  string
+	tarOutput            string
+	failFast             bool
+	files                []string
+	watch                bool
+	sortLists            bool
+	groupOutput          bool
+	reorderMetadata      bool
+	output               string
+	maxResources         int
+	quiet                bool
+	strict               bool
+	stream               bool
+	leadingSeparator     bool
+	provider             string
+	passthroughUnchanged bool
+	formatByKind         map[string]string
+	dir                  string
+	inPlace              bool
+
+	// stdin is read instead of os.Stdin and stdout written instead of
+	// os.Stdout by --stream if set.
+	stdin  io.Reader
+	stdout io.Writer
+
+	crlf        bool
+	tarEntries  []tarEntry
+	tarFiles    [][]byte
+	warnings    warnings
+	unchanged   map[*unstructured.Unstructured][]byte
+	kindFormats map[string]string
+}
+
+func (o *ioOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.preserveBlockScalars, "preserve-block-scalars", false, "Emit multi-line string values as literal block scalars")
+	fs.BoolVar(&o.baseFromCluster, "base-from-cluster", false, "Apply mutations on top of the live resources fetched from the cluster")
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file used with --base-from-cluster")
+	fs.StringVar(&o.schema, "schema", "", "Path to a JSON schema file used to validate the emitted resources of matching kinds")
+	fs.BoolVar(&o.trailingNewline, "trailing-newline", true, "End the output with a single newline")
+	fs.BoolVar(&o.normalizeStyle, "normalize-style", false, "Emit plain booleans and numbers and double-quoted strings")
+	fs.BoolVar(&o.preserveLineEndings, "preserve-line-endings", false, "Emit CRLF line endings when the input uses them")
+	fs.StringVar(&o.push, "push", "", "Also push the output as an OCI artifact to oci://registry/repo:tag")
+	fs.BoolVar(&o.printConfig, "print-config", false, "Print the effective flags and environment variables to stderr before processing")
+	fs.StringVar(&o.fieldMode, "field-mode", fieldModeCreateIfMissing, "Whether mutations may create missing parent fields (create-if-missing) or only change fields whose parent exists (patch-if-exists)")
+	fs.BoolVar(&o.sortLists, "sort-lists", false, "Sort list fields whose order has no meaning, like addons, subnets and tags, for stable diffs")
+	fs.StringVarP(&o.output, "output", "o", "", "Write the result to the file instead of stdout, - for stdout")
+	fs.BoolVar(&o.quiet, "quiet", false, "Suppress warnings")
+	fs.BoolVar(&o.strict, "strict", false, "Fail if there are any warnings")
+	fs.IntVar(&o.maxResources, "max-resources", 0, "Fail if the input has more resources than this, unlimited when 0")
+	fs.BoolVar(&o.reorderMetadata, "reorder-metadata", false, "Emit the metadata fields in the order name, namespace, labels, annotations instead of alphabetically in YAML output")
+	fs.BoolVar(&o.passthroughUnchanged, "passthrough-unchanged", false, "Write the resources left unchanged by the mutations exactly as in the input, with their comments and key order, in YAML output")
+	fs.StringVar(&o.provider, "provider", "", "Emit only the resources of the provider after the mutations, one of capa, capg, capk, capz or capi for the core Cluster API resources")
+	fs.BoolVar(&o.leadingSeparator, "leading-separator", false, "Start every YAML document with ---, including the first")
+	fs.BoolVar(&o.groupOutput, "group-output", false, "Emit the resources sorted by API group and kind, each group headed by a comment banner")
+	fs.StringVar(&o.outputFormat, "output-format", outputFormatYAML, "Output format, one of yaml, json or jsonl")
+	fs.StringToStringVar(&o.formatByKind, "format-by-kind", nil, "Format of the documents of a kind in YAML output, in Kind=format format where format is yaml or json (repeatable)")
+	fs.BoolVar(&o.failFast, "fail-fast", true, "Validate the flags against the input kinds before mutating, use --fail-fast=false to validate after the mutations")
+	fs.StringArrayVarP(&o.files, "file", "f", nil, "Read the manifest from the file instead of stdin, - for stdin (repeatable, the files are concatenated)")
+	fs.StringVar(&o.dir, "dir", "", "With --in-place, process every .yaml and .yml file below the directory separately")
+	fs.BoolVar(&o.inPlace, "in-place", false, "With --dir, write the result of every file back to the file")
+	fs.BoolVar(&o.watch, "watch", false, "With --file, process the files again whenever one of them changes")
+	fs.StringVar(&o.tar, "tar", "", "Read the .yaml entries of a tar or tar.gz archive, in entry order, instead of stdin")
+	fs.StringVar(&o.tarOutput, "tar-output", "", "With --tar, write the result into a new tar archive with the same entry names instead of stdout")
+	fs.BoolVar(&o.stream, "stream", false, "Read stdin and write every resource as soon as its document is complete, validations that need the whole input run at the end")
+	fs.StringArrayVar(&o.asserts, "assert", nil, "Fail unless the field equals the value on every resource of the kind, in Kind:dotted.path=value format (repeatable)")
+}
+
+// printEffectiveConfig prints the resolved value of every flag of fs and of
+// the given environment variables as YAML to stderr, when --print-config
+// is set. Credential bearing values are redacted.
+func (o *ioOptions) printEffectiveConfig(fs *pflag.FlagSet, envs ...string) error {
+	if !o.printConfig {
+		return nil
+	}
+	flags := map[string]string{}
+	fs.VisitAll(func(f *pflag.Flag) {
+		flags[f.Name] = redact(f.Name, f.Value.String())
+	})
+	env := map[string]string{}
+	for _, name := range envs {
+		env[name] = redact(name, os.Getenv(name))
+	}
+	data, err := yaml.Marshal(map[string]any{
+		"flags": flags,
+		"env":   env,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = os.Stderr.Write(data)
+	return err
+}
+
+func redact(name, value string) string {
+	name = strings.ToLower(name)
+	for _, s := range []string{"secret", "password", "token", "credential"} {
+		if value != "" && strings.Contains(name, s) {
+			return "<redacted>"
+		}
+	}
+	return value
+}
+
+// readInput reads the manifest from stdin, or from the files given with
+// --file or the archive given with --tar. With --stream nothing is read up
+// front, the documents are read by processResources instead.
+//
+// CRLF line endings are normalized to LF, so that document splitting works
+// on manifests authored on Windows.
+func (o *ioOptions) readInput() ([]byte, error) {
+	if o.tarOutput != "" && o.tar == "" {
+		return nil, errors.New("--tar-output requires --tar")
+	}
+	if err := o.validateStream(); err != nil {
+		return nil, err
+	}
+	if o.stream {
+		return nil, nil
+	}
+	var in []byte
+	var err error
+	if o.tar != "" && len(o.files) > 0 {
+		return nil, errors.New("--tar and --file are mutually exclusive")
+	}
+	if o.tar != "" {
+		in, o.tarEntries, err = readTar(o.tar)
+	} else if len(o.files) > 0 {
+		if o.dir == "" && stdinPiped() && !slices.Contains(o.files, "-") {
+			return nil, errors.New("input is piped to stdin and given with --file, choose one or add --file - to read stdin as one of the files")
+		}
+		in, err = readFiles(o.files, o.stdinReader())
+	} else {
+		in, err = io.ReadAll(o.stdinReader())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(in)) == 0 {
+		return nil, errNoInput
+	}
+	o.crlf = bytes.Contains(in, []byte("\r\n"))
+	if o.crlf {
+		in = bytes.ReplaceAll(in, []byte("\r\n"), []byte("\n"))
+	}
+	return in, nil
+}
+
+// stdinReader returns the reader of stdin.
+func (o *ioOptions) stdinReader() io.Reader {
+	if o.stdin != nil {
+		return o.stdin
+	}
+	return os.Stdin
+}
+
+// stdinPiped reports whether stdin is a pipe or a non-empty file. Terminals,
+// /dev/null, sockets and empty files inherited from a CI runner or a parent
+// process don't count as input.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	switch {
+	case fi.Mode()&os.ModeNamedPipe != 0:
+		return true
+	case fi.Mode().IsRegular():
+		return fi.Size() > 0
+	}
+	return false
+}
+
+// readFiles returns the content of files, concatenated as separate YAML
+// documents. The file - is read from stdin.
+func readFiles(files []string, stdin io.Reader) ([]byte, error) {
+	docs := make([][]byte, 0, len(files))
+	for _, f := range files {
+		var data []byte
+		var err error
+		if f == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input file %s: %w", f, err)
+		}
+		docs = append(docs, bytes.TrimRight(data, "\n"))
+	}
+	return append(bytes.Join(docs, []byte("\n---\n")), '\n'), nil
+}
+
+// kinds returns the kinds of the resources of in matched by match, or of
+// all resources if match is nil.
+func (o *ioOptions) kinds(in []byte, match resourceFilter) (map[string]bool, error) {
+	kinds := make(map[string]bool)
+	err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		if match == nil || match(ri.Object) {
+			kinds[ri.Object.GetKind()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kinds, nil
+}
+
+// checkResourceCount returns an error if in has more resources than
+// --max-resources, counted before any resource is processed.
+func (o *ioOptions) checkResourceCount(in []byte) error {
+	if o.maxResources < 0 {
+		return fmt.Errorf("invalid max resources %d, must not be negative", o.maxResources)
+	}
+	if o.maxResources == 0 {
+		return nil
+	}
+	n, err := countResources(in)
+	if err != nil {
+		return err
+	}
+	if n > o.maxResources {
+		return fmt.Errorf("input has %d resources, more than the limit of %d", n, o.maxResources)
+	}
+	return nil
+}
+
+func countResources(in []byte) (int, error) {
+	var n int
+	err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// processResources runs fns in order on every resource of in and returns
+// the result encoded in the selected output format. With --stream in is
+// ignored, the resources are read from stdin and written to stdout one by
+// one and no result is returned.
+func (o *ioOptions) processResources(in []byte, fns ...parser.ResourceFn) ([]byte, error) {
+	if err := validateOutputFormat(o.outputFormat); err != nil {
+		return nil, err
+	}
+	if err := validateFieldMode(o.fieldMode); err != nil {
+		return nil, err
+	}
+	if err := validateProvider(o.provider); err != nil {
+		return nil, err
+	}
+	kindFormats, err := o.resolveKindFormats()
+	if err != nil {
+		return nil, err
+	}
+	o.kindFormats = kindFormats
+	if o.groupOutput && o.outputFormat != outputFormatYAML {
+		return nil, fmt.Errorf("--group-output can't be used with the %s output format", o.outputFormat)
+	}
+	if !o.stream {
+		if err := o.checkResourceCount(in); err != nil {
+			return nil, err
+		}
+	} else if o.maxResources < 0 {
+		return nil, fmt.Errorf("invalid max resources %d, must not be negative", o.maxResources)
+	}
+	var live *liveClient
+	if o.baseFromCluster {
+		var err error
+		live, err = newLiveClient(o.kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var sv *schemaValidator
+	if o.schema != "" {
+		var err error
+		sv, err = newSchemaValidator(o.schema)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	asserts := make([]*assertion, 0, len(o.asserts))
+	for _, s := range o.asserts {
+		a, err := parseAssertion(s)
+		if err != nil {
+			return nil, err
+		}
+		asserts = append(asserts, a)
+	}
+
+	var objs []*unstructured.Unstructured
+	var objEntries []int // index into o.tarEntries of every object
+	var violations []error
+	var entry, seen, n, written int
+	var doc []byte // the input document of a single resource, with --passthrough-unchanged
+	o.unchanged = make(map[*unstructured.Unstructured][]byte)
+	handle := func(ri parser.ResourceInfo) error {
+		if n++; o.stream && o.maxResources > 0 && n > o.maxResources {
+			return fmt.Errorf("input has more resources than the limit of %d", o.maxResources)
+		}
+		for entry < len(o.tarEntries) && seen == o.tarEntries[entry].count {
+			entry, seen = entry+1, 0
+		}
+		seen++
+
+		var input map[string]any
+		if doc != nil {
+			input = ri.Object.DeepCopy().UnstructuredContent()
+		}
+		warnUnknownSkipTokens(ri.Object, &o.warnings)
+		if live != nil {
+			if err := live.rebase(ri.Object); err != nil {
+				return err
+			}
+		}
+		var orig map[string]any
+		if o.fieldMode == fieldModePatchIfExists {
+			orig = ri.Object.DeepCopy().UnstructuredContent()
+		}
+		for _, fn := range fns {
+			if err := fn(ri); err != nil {
+				return err
+			}
+		}
+		if orig != nil {
+			dropCreatedParents(orig, ri.Object.UnstructuredContent(), nil, ri.Object.GetKind(), ri.Object.GetName(), &o.warnings)
+		}
+		if sv != nil {
+			if err := sv.validate(ri.Object); err != nil {
+				violations = append(violations, err)
+			}
+		}
+		for _, a := range asserts {
+			if err := a.check(ri.Object); err != nil {
+				violations = append(violations, err)
+			}
+		}
+		if o.provider != "" && providerOf(ri.Object) != o.provider {
+			return nil
+		}
+		if input != nil && reflect.DeepEqual(input, ri.Object.UnstructuredContent()) {
+			o.unchanged[ri.Object] = doc
+		}
+		if written++; o.stream {
+			return o.streamObject(ri.Object, written == 1)
+		}
+		objs = append(objs, ri.Object)
+		objEntries = append(objEntries, entry)
+		return nil
+	}
+	processDocument := func(data []byte) error {
+		doc = nil
+		if o.passthroughUnchanged && o.outputFormat == outputFormatYAML {
+			if count, err := countResources(data); err == nil && count == 1 {
+				doc = append(bytes.TrimRight(data, "\n"), '\n')
+			}
+		}
+		return parser.ProcessResources(data, handle)
+	}
+	if o.stream {
+		err = o.streamDocuments(processDocument)
+		if err == nil && n == 0 {
+			err = errNoInput
+		}
+		if err == nil {
+			err = o.endStream(written)
+		}
+	} else if o.passthroughUnchanged {
+		err = readDocuments(bytes.NewReader(in), processDocument)
+	} else {
+		err = parser.ProcessResources(in, handle)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range asserts {
+		if !a.matched {
+			violations = append(violations, fmt.Errorf("assertion %s=%s failed: no %s found", a.field, a.value, a.field.kind))
+		}
+	}
+	if err := errors.Join(violations...); err != nil {
+		return nil, err
+	}
+	if o.stream {
+		return nil, nil
+	}
+	o.tarFiles = nil
+	if o.tarOutput != "" {
+		if o.tarFiles, err = o.encodeTarEntries(objs, objEntries); err != nil {
+			return nil, err
+		}
+	}
+	return o.encode(objs)
+}
+
+// encodeTarEntries encodes the objects of every tar entry separately, so
+// that write can store them in --tar-output under the original entry names.
+func (o *ioOptions) encodeTarEntries(objs []*unstructured.Unstructured, objEntries []int) ([][]byte, error) {
+	grouped := make([][]*unstructured.Unstructured, len(o.tarEntries))
+	for i, obj := range objs {
+		grouped[objEntries[i]] = append(grouped[objEntries[i]], obj)
+	}
+	files := make([][]byte, len(o.tarEntries))
+	for i := range grouped {
+		data, err := o.encode(grouped[i])
+		if err != nil {
+			return nil, err
+		}
+		files[i] = data
+	}
+	return files, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestReadInputEmpty(t *testing.T) {
+	tests := []struct {
+		name  string
+		stdin string
+		files []string
+	}{
+		{name: "empty stdin", stdin: ""},
+		{name: "whitespace only stdin", stdin: " \n\t\n"},
+		{name: "CRLF only stdin", stdin: "\r\n\r\n"},
+		{name: "empty stdin as file", stdin: "", files: []string{"-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := ioOptions{stdin: strings.NewReader(tt.stdin), files: tt.files}
+			if _, err := o.readInput(); !errors.Is(err, errNoInput) {
+				t.Errorf("readInput() error = %v, want %v", err, errNoInput)
+			}
+		})
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	o := ioOptions{stdin: strings.NewReader(machineDeploymentYAML)}
+	in, err := o.readInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(in) != machineDeploymentYAML {
+		t.Errorf("readInput() = %q, want %q", in, machineDeploymentYAML)
+	}
+}
+
+// benchmarkManifest returns a manifest of n MachineDeployments.
+func benchmarkManifest(n int) []byte {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		b.WriteString(strings.Replace(machineDeploymentYAML, "name: c1-md-0", fmt.Sprintf("name: c1-md-%d", i), 1))
+	}
+	return []byte(b.String())
+}
+
+// BenchmarkProcessResources compares reading the whole input up front with
+// processing it document by document with --stream.
+func BenchmarkProcessResources(b *testing.B) {
+	in := benchmarkManifest(5000)
+	fn := func(ri parser.ResourceInfo) error {
+		return setField(ri, "bench", "metadata", "labels", "capi-config")
+	}
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(in)))
+		for i := 0; i < b.N; i++ {
+			o := ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing, trailingNewline: true}
+			if _, err := o.processResources(in, fn); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(in)))
+		for i := 0; i < b.N; i++ {
+			o := ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing, trailingNewline: true, stream: true, stdin: bytes.NewReader(in), stdout: io.Discard}
+			if _, err := o.processResources(nil, fn); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
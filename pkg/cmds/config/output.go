@@ -0,0 +1,187 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+	yamlv3 "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+const (
+	outputFormatYAML  = "yaml"
+	outputFormatJSON  = "json"
+	outputFormatJSONL = "jsonl"
+)
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputFormatYAML, outputFormatJSON, outputFormatJSONL:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
+
+// resolveKindFormats validates --format-by-kind and returns the format of
+// every kind, with the kind aliases resolved. The documents of a YAML
+// stream may be written as JSON, which is valid YAML, but not the other
+// way around, so the global format must be yaml.
+func (o *ioOptions) resolveKindFormats() (map[string]string, error) {
+	if len(o.formatByKind) == 0 {
+		return nil, nil
+	}
+	if o.outputFormat != outputFormatYAML {
+		return nil, fmt.Errorf("--format-by-kind can't be used with the %s output format", o.outputFormat)
+	}
+	formats := make(map[string]string, len(o.formatByKind))
+	for k, format := range o.formatByKind {
+		if format != outputFormatYAML && format != outputFormatJSON {
+			return nil, fmt.Errorf("invalid format %q for kind %s, expected yaml or json", format, k)
+		}
+		kind, err := resolveKind(k)
+		if err != nil {
+			return nil, err
+		}
+		formats[kind] = format
+	}
+	return formats, nil
+}
+
+// encode renders objs in the selected output format, either as a
+// multi-document YAML stream, as a JSON array or as JSON Lines with one
+// compact object per line. With --group-output the objects are sorted by API group and kind,
+// and every group starts with a comment banner. With --leading-separator the
+// first YAML document starts with a separator too. Resources left unchanged
+// are written as in the input with --passthrough-unchanged, and the kinds
+// of --format-by-kind as JSON documents.
+func (o *ioOptions) encode(objs []*unstructured.Unstructured) ([]byte, error) {
+	var out bytes.Buffer
+	var group string
+	if o.groupOutput {
+		objs = groupObjects(objs)
+	}
+	if o.sortLists {
+		for _, obj := range objs {
+			sortLists(obj.Object)
+		}
+	}
+	if o.outputFormat == outputFormatJSON {
+		if objs == nil {
+			objs = []*unstructured.Unstructured{}
+		}
+		data, err := json.MarshalIndent(objs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	for _, obj := range objs {
+		switch o.outputFormat {
+		case outputFormatJSONL:
+			data, err := json.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(data)
+			out.WriteByte('\n')
+		default:
+			data, ok := o.unchanged[obj]
+			isJSON := o.kindFormats[obj.GetKind()] == outputFormatJSON
+			if isJSON {
+				var err error
+				if data, err = json.MarshalIndent(obj, "", "  "); err != nil {
+					return nil, err
+				}
+				data = append(data, '\n')
+			} else if !ok {
+				var err error
+				if data, err = o.marshal(obj); err != nil {
+					return nil, err
+				}
+			}
+			// A stream starting with { is decoded as JSON by the Kubernetes
+			// decoders, so a JSON first document is preceded by a separator.
+			if out.Len() > 0 || o.leadingSeparator || (isJSON && !o.groupOutput) {
+				out.WriteString("---\n")
+			}
+			if o.groupOutput && outputGroup(obj) != group {
+				group = outputGroup(obj)
+				out.WriteString(groupBanner(group))
+			}
+			out.Write(data)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func (o *ioOptions) marshal(obj *unstructured.Unstructured) ([]byte, error) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	if !o.preserveBlockScalars && !o.normalizeStyle && !o.reorderMetadata {
+		return data, nil
+	}
+	return restyle(data, func(doc *yamlv3.Node) {
+		walkValues(doc, func(n *yamlv3.Node) {
+			if o.normalizeStyle {
+				normalizeStyle(n)
+			}
+			if o.preserveBlockScalars {
+				setLiteralStyle(n)
+			}
+		})
+		if o.reorderMetadata {
+			reorderMetadata(doc)
+		}
+	})
+}
+
+// write writes data to --output or stdout, or the tar entries encoded by
+// processResources to --tar-output.
+func (o *ioOptions) write(data []byte) error {
+	if len(data) > 0 {
+		data = bytes.TrimRight(data, "\n")
+		if o.trailingNewline {
+			data = append(data, '\n')
+		}
+	}
+	if o.preserveLineEndings && o.crlf {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	if o.tarOutput != "" {
+		if err := writeTar(o.tarOutput, o.tarEntries, o.tarFiles); err != nil {
+			return fmt.Errorf("failed to write tar output %s: %w", o.tarOutput, err)
+		}
+	} else if o.output != "" && o.output != "-" {
+		if err := os.WriteFile(o.output, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write output file %s: %w", o.output, err)
+		}
+	} else if _, err := os.Stdout.Write(data); err != nil {
+		return err
+	}
+	if o.push != "" {
+		return pushOCI(context.Background(), o.push, data)
+	}
+	return nil
+}
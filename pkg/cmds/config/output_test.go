@@ -0,0 +1,67 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestOutputFormatJSONL(t *testing.T) {
+	in, err := os.ReadFile("testdata/fixed-size.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := ioOptions{outputFormat: outputFormatJSONL, fieldMode: fieldModeCreateIfMissing}
+	out, err := o.processResources(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(out, []byte("\n")) {
+		t.Errorf("output doesn't end with a newline: %q", out)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(out, []byte("\n")), []byte("\n"))
+	want := []string{"fixed", "autoscaled", "fixed-md"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), out)
+	}
+	for i, line := range lines {
+		var obj struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(line, &obj); err != nil {
+			t.Errorf("line %d doesn't parse as JSON: %v\n%s", i+1, err, line)
+			continue
+		}
+		if obj.Metadata.Name != want[i] {
+			t.Errorf("line %d name = %q, want %q", i+1, obj.Metadata.Name, want[i])
+		}
+	}
+}
+
+func TestOutputFormatUnsupported(t *testing.T) {
+	o := ioOptions{outputFormat: "list", fieldMode: fieldModeCreateIfMissing}
+	if _, err := o.processResources([]byte(machinePoolYAML)); err == nil {
+		t.Error("processResources() accepted an unsupported output format")
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"kmodules.xyz/client-go/tools/parser"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	pipelineOpSet    = "set"
+	pipelineOpUnset  = "unset"
+	pipelineOpAppend = "append"
+	pipelineOpLabel  = "label"
+)
+
+// pipelineStep is a single transform of a --pipeline file. Steps without a
+// kind apply to every resource.
+type pipelineStep struct {
+	Name  string `json:"name,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Value any    `json:"value,omitempty"`
+
+	path []string
+}
+
+func (s pipelineStep) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Op
+}
+
+// readPipeline reads and validates the list of steps of a pipeline file.
+func readPipeline(name string) ([]pipelineStep, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline: %w", err)
+	}
+	var steps []pipelineStep
+	if err := yaml.UnmarshalStrict(data, &steps); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline %s: %w", name, err)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("pipeline %s has no steps", name)
+	}
+	for i := range steps {
+		if err := steps[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid pipeline step %d (%s): %w", i+1, steps[i], err)
+		}
+	}
+	return steps, nil
+}
+
+func (s *pipelineStep) validate() error {
+	if s.Kind != "" {
+		kind, err := resolveKind(s.Kind)
+		if err != nil {
+			return err
+		}
+		s.Kind = kind
+	}
+	switch s.Op {
+	case pipelineOpSet, pipelineOpAppend:
+		if s.Value == nil {
+			return fmt.Errorf("%s requires a value", s.Op)
+		}
+		fallthrough
+	case pipelineOpUnset:
+		if s.Path == "" {
+			return fmt.Errorf("%s requires a path", s.Op)
+		}
+		if s.Key != "" {
+			return fmt.Errorf("%s does not take a key", s.Op)
+		}
+		s.path = strings.Split(s.Path, ".")
+	case pipelineOpLabel:
+		if s.Path != "" {
+			return errors.New("label does not take a path")
+		}
+		if errs := kvalidation.IsQualifiedName(s.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", s.Key, strings.Join(errs, "; "))
+		}
+		v, ok := s.Value.(string)
+		if !ok {
+			return fmt.Errorf("label value of %q must be a string", s.Key)
+		}
+		if errs := kvalidation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid label value %q: %s", v, strings.Join(errs, "; "))
+		}
+	case "":
+		return errors.New("op is missing")
+	default:
+		return fmt.Errorf("unknown op %q, expected one of set, unset, append or label", s.Op)
+	}
+	s.Value = toUnstructuredValue(s.Value)
+	return nil
+}
+
+// applyPipeline runs the steps in order on ri, skipping the steps of other
+// kinds.
+func applyPipeline(ri parser.ResourceInfo, steps []pipelineStep) error {
+	for i, s := range steps {
+		if s.Kind != "" && s.Kind != ri.Object.GetKind() {
+			continue
+		}
+		if err := s.apply(ri); err != nil {
+			return fmt.Errorf("pipeline step %d (%s) failed on %s/%s: %w", i+1, s, ri.Object.GetKind(), ri.Object.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func (s pipelineStep) apply(ri parser.ResourceInfo) error {
+	switch s.Op {
+	case pipelineOpSet:
+		return setField(ri, s.Value, s.path...)
+	case pipelineOpUnset:
+		unstructured.RemoveNestedField(ri.Object.UnstructuredContent(), s.path...)
+	case pipelineOpAppend:
+		list, _, err := unstructured.NestedSlice(ri.Object.UnstructuredContent(), s.path...)
+		if err != nil {
+			return fmt.Errorf("failed to append to %s: %w", s.Path, err)
+		}
+		return setField(ri, append(list, s.Value), s.path...)
+	case pipelineOpLabel:
+		return setField(ri, s.Value, "metadata", "labels", s.Key)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const capiProvider = "capi"
+
+// providerKindPrefixes maps the providers accepted by --provider to the
+// kind prefix of their resources. The Cluster API groups are shared by all
+// providers, so the kind prefix tells the infrastructure providers apart.
+// Everything else in a Cluster API group belongs to the core provider capi.
+var providerKindPrefixes = map[string][]string{
+	"capa": {"AWS", "EKS", "ROSA"},
+	"capg": {"GCP"},
+	"capk": {"Kubevirt"},
+	"capz": {"Azure"},
+}
+
+// providerOf returns the provider of obj, or the empty string if obj is
+// not a Cluster API resource, like a ConfigMap or Secret.
+func providerOf(obj *unstructured.Unstructured) string {
+	group := obj.GroupVersionKind().Group
+	if group != "cluster.x-k8s.io" && !strings.HasSuffix(group, ".cluster.x-k8s.io") {
+		return ""
+	}
+	for provider, prefixes := range providerKindPrefixes {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(obj.GetKind(), prefix) {
+				return provider
+			}
+		}
+	}
+	return capiProvider
+}
+
+func validateProvider(provider string) error {
+	if provider == "" || provider == capiProvider {
+		return nil
+	}
+	if _, ok := providerKindPrefixes[provider]; ok {
+		return nil
+	}
+	providers := []string{capiProvider}
+	for p := range providerKindPrefixes {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	return fmt.Errorf("invalid provider %q, expected one of %s", provider, strings.Join(providers, ", "))
+}
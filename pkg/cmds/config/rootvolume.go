@@ -0,0 +1,100 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// awsRootVolumePaths maps the CAPA kinds to the path of the root volume of
+// their instances.
+var awsRootVolumePaths = map[string][]string{
+	"AWSMachineTemplate": {"spec", "template", "spec", "rootVolume"},
+	"AWSMachinePool":     {"spec", "awsLaunchTemplate", "rootVolume"},
+}
+
+// ebsVolumeIOPS holds the provisioned IOPS bounds of the EBS volume types.
+// Types that don't support provisioned IOPS have none.
+var ebsVolumeIOPS = map[string]*struct{ min, max int64 }{
+	"standard": nil,
+	"gp2":      nil,
+	"gp3":      {min: 3000, max: 16000},
+	"io1":      {min: 100, max: 64000},
+	"io2":      {min: 100, max: 256000},
+	"st1":      nil,
+	"sc1":      nil,
+}
+
+// rootVolume is the root volume configuration, where zero values are left
+// unchanged.
+type rootVolume struct {
+	size       int64
+	volumeType string
+	iops       int64
+}
+
+func (v rootVolume) isSet() bool {
+	return v.size != 0 || v.volumeType != "" || v.iops != 0
+}
+
+func (v rootVolume) validate() error {
+	if v.size != 0 && (v.size < 8 || v.size > 16384) {
+		return fmt.Errorf("invalid root volume size %d, expected 8 to 16384 GiB", v.size)
+	}
+	if v.volumeType != "" {
+		if _, ok := ebsVolumeIOPS[v.volumeType]; !ok {
+			types := make([]string, 0, len(ebsVolumeIOPS))
+			for t := range ebsVolumeIOPS {
+				types = append(types, t)
+			}
+			sort.Strings(types)
+			return fmt.Errorf("invalid root volume type %q, expected one of %s", v.volumeType, strings.Join(types, ", "))
+		}
+	}
+	if v.iops != 0 {
+		bounds := ebsVolumeIOPS[v.volumeType]
+		if bounds == nil {
+			return fmt.Errorf("invalid root volume iops %d, provisioned iops require a gp3, io1 or io2 root volume type", v.iops)
+		}
+		if v.iops < bounds.min || v.iops > bounds.max {
+			return fmt.Errorf("invalid root volume iops %d, expected %d to %d for %s", v.iops, bounds.min, bounds.max, v.volumeType)
+		}
+	}
+	return nil
+}
+
+// setAWSRootVolume sets the root volume of ri. It returns false if ri has
+// no root volume.
+func setAWSRootVolume(ri parser.ResourceInfo, v rootVolume) (bool, error) {
+	path, ok := awsRootVolumePaths[ri.Object.GetKind()]
+	if !ok {
+		return false, nil
+	}
+	for field, value := range map[string]any{"size": v.size, "type": v.volumeType, "iops": v.iops} {
+		if value == int64(0) || value == "" {
+			continue
+		}
+		if err := setField(ri, value, append(path, field)...); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestSetAWSRootVolume(t *testing.T) {
+	tests := []struct {
+		name      string
+		ri        parser.ResourceInfo
+		v         rootVolume
+		path      []string
+		wantFound bool
+		want      map[string]any
+	}{
+		{
+			name:      "machine template",
+			ri:        newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", "AWSMachineTemplate", nil),
+			v:         rootVolume{size: 100, volumeType: "gp3", iops: 4000},
+			path:      []string{"spec", "template", "spec", "rootVolume"},
+			wantFound: true,
+			want:      map[string]any{"size": int64(100), "type": "gp3", "iops": int64(4000)},
+		},
+		{
+			name:      "machine pool keeps unset fields",
+			ri:        newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", "AWSMachinePool", map[string]any{"awsLaunchTemplate": map[string]any{"rootVolume": map[string]any{"type": "gp2"}}}),
+			v:         rootVolume{size: 50},
+			path:      []string{"spec", "awsLaunchTemplate", "rootVolume"},
+			wantFound: true,
+			want:      map[string]any{"size": int64(50), "type": "gp2"},
+		},
+		{
+			name: "kind without root volume",
+			ri:   newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", awsManagedMachinePoolKind, nil),
+			v:    rootVolume{size: 50},
+			path: []string{"spec", "rootVolume"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := setAWSRootVolume(tt.ri, tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.wantFound {
+				t.Errorf("setAWSRootVolume() found = %v, want %v", found, tt.wantFound)
+			}
+			got, _, _ := unstructured.NestedMap(tt.ri.Object.Object, tt.path...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("root volume = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
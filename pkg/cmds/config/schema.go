@@ -0,0 +1,91 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type schemaValidator struct {
+	schema *jsonschema.Schema
+	kinds  map[string]bool
+}
+
+func newSchemaValidator(path string) (*schemaValidator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", path, err)
+	}
+
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(path, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	schema, err := c.Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &schemaValidator{
+		schema: schema,
+		kinds:  schemaKinds(raw),
+	}, nil
+}
+
+// schemaKinds returns the kinds a schema applies to, read from the
+// x-kubernetes-group-version-kind extension or the enum/const of the
+// kind property. An empty result means the schema applies to every kind.
+func schemaKinds(raw map[string]any) map[string]bool {
+	kinds := make(map[string]bool)
+	gvks, _, _ := unstructured.NestedSlice(raw, "x-kubernetes-group-version-kind")
+	for _, gvk := range gvks {
+		if m, ok := gvk.(map[string]any); ok {
+			if kind, ok := m["kind"].(string); ok {
+				kinds[kind] = true
+			}
+		}
+	}
+	if kind, ok, _ := unstructured.NestedString(raw, "properties", "kind", "const"); ok {
+		kinds[kind] = true
+	}
+	enum, _, _ := unstructured.NestedSlice(raw, "properties", "kind", "enum")
+	for _, kind := range enum {
+		if s, ok := kind.(string); ok {
+			kinds[s] = true
+		}
+	}
+	return kinds
+}
+
+func (v *schemaValidator) validate(obj *unstructured.Unstructured) error {
+	if len(v.kinds) > 0 && !v.kinds[obj.GetKind()] {
+		return nil
+	}
+	if err := v.schema.Validate(obj.UnstructuredContent()); err != nil {
+		return fmt.Errorf("%s/%s does not match schema: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return nil
+}
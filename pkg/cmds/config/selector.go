@@ -0,0 +1,63 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// resourceFilter reports whether the mutations apply to obj.
+type resourceFilter func(obj *unstructured.Unstructured) bool
+
+// newResourceFilter returns a filter matching the resources with labels
+// matching selector, like key=value,key2=value2, and the given name. It
+// returns nil if both are empty.
+func newResourceFilter(selector, name string) (resourceFilter, error) {
+	if selector == "" && name == "" {
+		return nil, nil
+	}
+	sel := labels.Everything()
+	if selector != "" {
+		var err error
+		if sel, err = labels.Parse(selector); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+	}
+	return func(obj *unstructured.Unstructured) bool {
+		return sel.Matches(labels.Set(obj.GetLabels())) && (name == "" || obj.GetName() == name)
+	}, nil
+}
+
+// filterResources returns a ResourceFn that runs fns on the resources
+// matched by match and passes the others through unchanged.
+func filterResources(match resourceFilter, fns ...parser.ResourceFn) parser.ResourceFn {
+	return func(ri parser.ResourceInfo) error {
+		if !match(ri.Object) {
+			return nil
+		}
+		for _, fn := range fns {
+			if err := fn(ri); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
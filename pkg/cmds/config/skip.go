@@ -0,0 +1,74 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// skipAnnotation lets a manifest opt a single resource out of some of the
+// mutations, given as a comma separated list of tokens, e.g.
+//
+//	capi-config.appscode.com/skip: "scaling,network"
+//
+// The recognized tokens are:
+//
+//	scaling   - min/max/desired size of machine pools and the autoscaler annotations
+//	network   - VPC, subnet and secondary CIDR configuration of the control plane
+//	rollout   - spec.rolloutAfter set by --rollout-now
+//	transform - --add-labels, --add-annotations, --fixed-size-cleanup and --append
+const skipAnnotation = "capi-config.appscode.com/skip"
+
+const (
+	skipScaling   = "scaling"
+	skipNetwork   = "network"
+	skipRollout   = "rollout"
+	skipTransform = "transform"
+)
+
+var skipTokens = map[string]bool{
+	skipScaling:   true,
+	skipNetwork:   true,
+	skipRollout:   true,
+	skipTransform: true,
+}
+
+// skipped reports whether obj opts out of the mutations named by token.
+func skipped(obj *unstructured.Unstructured, token string) bool {
+	for _, t := range strings.Split(obj.GetAnnotations()[skipAnnotation], ",") {
+		if strings.TrimSpace(t) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// warnUnknownSkipTokens adds a warning for the tokens of the skip annotation of obj that
+// don't name any mutation, which are most likely typos.
+func warnUnknownSkipTokens(obj *unstructured.Unstructured, w *warnings) {
+	v, ok := obj.GetAnnotations()[skipAnnotation]
+	if !ok {
+		return
+	}
+	for _, t := range strings.Split(v, ",") {
+		if t = strings.TrimSpace(t); t != "" && !skipTokens[t] {
+			w.add("%s/%s: unknown token %q in %s annotation", obj.GetKind(), obj.GetName(), t, skipAnnotation)
+		}
+	}
+}
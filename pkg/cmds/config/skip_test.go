@@ -0,0 +1,99 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// TestSkipScaling checks that the skip annotation turns off scaling for the
+// annotated pool only, and that the pool is still renamed.
+func TestSkipScaling(t *testing.T) {
+	in, err := os.ReadFile("testdata/skip-scaling.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type pool struct {
+		kind, name string
+		obj        *unstructured.Unstructured
+	}
+	var w warnings
+	var pools []pool
+	err = parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+		pools = append(pools, pool{kind: ri.Object.GetKind(), name: ri.Object.GetName(), obj: ri.Object})
+		if ri.Object.GetKind() == awsManagedMachinePoolKind {
+			return setAWSManagedMPScaling(&ri, ri.Object.GetName()+"-renamed", 2, 6, 0, &w)
+		}
+		return SetMPConfiguration(ri, ri.Object.GetName()+"-renamed", 2, 6, &w)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kind, name string
+		skipped    bool
+	}{
+		{kind: awsManagedMachinePoolKind, name: "capi-pool-0", skipped: true},
+		{kind: awsManagedMachinePoolKind, name: "capi-pool-1"},
+		{kind: machinePoolKind, name: "capi-pool-0", skipped: true},
+		{kind: machinePoolKind, name: "capi-pool-1"},
+	}
+	if len(pools) != len(tests) {
+		t.Fatalf("got %d pools, want %d", len(pools), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.kind+"/"+tt.name, func(t *testing.T) {
+			p := pools[i]
+			if p.kind != tt.kind || p.name != tt.name {
+				t.Fatalf("pool %d is %s/%s, want %s/%s", i, p.kind, p.name, tt.kind, tt.name)
+			}
+			if got, want := p.obj.GetName(), tt.name+"-renamed"; got != want {
+				t.Errorf("name = %q, want %q", got, want)
+			}
+			if tt.kind == awsManagedMachinePoolKind {
+				wantMax := int64(6)
+				if tt.skipped {
+					wantMax = 1
+				}
+				got, _, _ := unstructured.NestedInt64(p.obj.Object, "spec", "scaling", "maxSize")
+				if got != wantMax {
+					t.Errorf("spec.scaling.maxSize = %d, want %d", got, wantMax)
+				}
+				return
+			}
+			_, got := p.obj.GetAnnotations()[autoscalerMaxSizeAnnotation]
+			if got == tt.skipped {
+				t.Errorf("has %s annotation = %v, want %v", autoscalerMaxSizeAnnotation, got, !tt.skipped)
+			}
+		})
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAnnotations(map[string]string{skipAnnotation: "rollout, scaling"})
+	for token, want := range map[string]bool{skipScaling: true, skipRollout: true, skipNetwork: false, "scal": false} {
+		if got := skipped(obj, token); got != want {
+			t.Errorf("skipped(%q) = %v, want %v", token, got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// sortableLists are the list fields whose order has no meaning, so they can
+// be sorted for stable diffs. Lists not named here, like
+// preKubeadmCommands or ClusterResourceSet resources, are order-significant
+// and are never sorted.
+var sortableLists = map[string]bool{
+	"addons":                true,
+	"subnets":               true,
+	"subnetIDs":             true,
+	"availabilityZones":     true,
+	"tags":                  true,
+	"additionalNetworkTags": true,
+	"taints":                true,
+}
+
+// naturalKeys are the fields used, in order of preference, to sort lists of
+// objects.
+var naturalKeys = []string{"name", "id", "cidrBlock", "key"}
+
+// sortLists sorts the sortable lists found anywhere in obj. Lists with an
+// element without a natural key are left as is.
+func sortLists(obj map[string]any) {
+	for k, v := range obj {
+		switch u := v.(type) {
+		case map[string]any:
+			sortLists(u)
+		case []any:
+			for _, e := range u {
+				if m, ok := e.(map[string]any); ok {
+					sortLists(m)
+				}
+			}
+			if sortableLists[k] {
+				sortList(u)
+			}
+		}
+	}
+}
+
+func sortList(list []any) {
+	keys := make([]string, len(list))
+	for i, e := range list {
+		key, ok := naturalKey(e)
+		if !ok {
+			return
+		}
+		keys[i] = key
+	}
+	sort.Stable(byKey{list: list, keys: keys})
+}
+
+func naturalKey(e any) (string, bool) {
+	switch u := e.(type) {
+	case map[string]any:
+		for _, k := range naturalKeys {
+			if v, ok := u[k]; ok {
+				return fmt.Sprint(v), true
+			}
+		}
+		return "", false
+	case string, bool, int64, float64:
+		return fmt.Sprint(u), true
+	}
+	return "", false
+}
+
+type byKey struct {
+	list []any
+	keys []string
+}
+
+func (b byKey) Len() int           { return len(b.list) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.list[i], b.list[j] = b.list[j], b.list[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
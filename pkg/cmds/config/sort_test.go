@@ -0,0 +1,98 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const kubeadmConfigYAML = `apiVersion: bootstrap.cluster.x-k8s.io/v1beta1
+kind: KubeadmConfig
+metadata:
+  name: capi-pool-0
+  namespace: default
+spec:
+  tags:
+  - zone-b
+  - zone-a
+  preKubeadmCommands:
+  - systemctl restart containerd
+  - modprobe br_netfilter
+  - sysctl --system
+  postKubeadmCommands:
+  - echo done
+  - echo cleanup
+  subnets:
+  - cidrBlock: 10.0.2.0/24
+  - cidrBlock: 10.0.1.0/24
+`
+
+func TestSortLists(t *testing.T) {
+	tests := []struct {
+		name      string
+		sortLists bool
+		want      map[string][]any
+	}{
+		{
+			name: "disabled",
+			want: map[string][]any{
+				"tags":                {"zone-b", "zone-a"},
+				"preKubeadmCommands":  {"systemctl restart containerd", "modprobe br_netfilter", "sysctl --system"},
+				"postKubeadmCommands": {"echo done", "echo cleanup"},
+				"subnets":             {map[string]any{"cidrBlock": "10.0.2.0/24"}, map[string]any{"cidrBlock": "10.0.1.0/24"}},
+			},
+		},
+		{
+			name:      "enabled",
+			sortLists: true,
+			want: map[string][]any{
+				"tags":                {"zone-a", "zone-b"},
+				"preKubeadmCommands":  {"systemctl restart containerd", "modprobe br_netfilter", "sysctl --system"},
+				"postKubeadmCommands": {"echo done", "echo cleanup"},
+				"subnets":             {map[string]any{"cidrBlock": "10.0.1.0/24"}, map[string]any{"cidrBlock": "10.0.2.0/24"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(kubeadmConfigYAML), &obj.Object); err != nil {
+				t.Fatal(err)
+			}
+			o := ioOptions{outputFormat: outputFormatYAML, sortLists: tt.sortLists}
+			out, err := o.encode([]*unstructured.Unstructured{obj})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got struct {
+				Spec map[string][]any `json:"spec"`
+			}
+			if err := yaml.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range tt.want {
+				if !reflect.DeepEqual(got.Spec[field], want) {
+					t.Errorf("spec.%s = %v, want %v", field, got.Spec[field], want)
+				}
+			}
+		})
+	}
+}
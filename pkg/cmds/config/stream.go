@@ -0,0 +1,121 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ylib "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// validateStream returns an error if --stream is combined with flags that
+// need the whole input or output at once.
+func (o *ioOptions) validateStream() error {
+	if !o.stream {
+		return nil
+	}
+	switch {
+	case o.tar != "" || len(o.files) > 0 || o.watch:
+		return errors.New("--stream reads stdin and can't be used with --file, --tar or --watch")
+	case o.tarOutput != "" || o.push != "" || (o.output != "" && o.output != "-"):
+		return errors.New("--stream writes stdout and can't be used with --tar-output, --push or --output")
+	case o.groupOutput || o.outputFormat == outputFormatJSON:
+		return errors.New("--stream can't be used with --group-output or the json output format, which need all resources at once")
+	}
+	return nil
+}
+
+// validateFirst reports whether the flags are validated against the input
+// kinds before any resource is processed. With --stream the whole input is
+// never available, so validation is deferred until the end like with
+// --fail-fast=false.
+func (o *ioOptions) validateFirst() bool {
+	return o.failFast && !o.stream
+}
+
+// streamDocuments calls fn with every YAML document of stdin as soon as it
+// has been read.
+func (o *ioOptions) streamDocuments(fn func(doc []byte) error) error {
+	return readDocuments(o.stdinReader(), func(doc []byte) error {
+		if bytes.Contains(doc, []byte("\r\n")) {
+			o.crlf = true
+			doc = bytes.ReplaceAll(doc, []byte("\r\n"), []byte("\n"))
+		}
+		return fn(doc)
+	})
+}
+
+// readDocuments calls fn with every YAML document read from r.
+func readDocuments(r io.Reader, fn func(doc []byte) error) error {
+	yr := ylib.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := yr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// streamObject writes obj to stdout right away. The final newline of an
+// object is written together with the next one, so that endStream can
+// honor --trailing-newline.
+func (o *ioOptions) streamObject(obj *unstructured.Unstructured, first bool) error {
+	data, err := o.encode([]*unstructured.Unstructured{obj})
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if !first {
+		sep := "\n"
+		if o.outputFormat == outputFormatYAML && !bytes.HasPrefix(data, []byte("---\n")) {
+			sep = "\n---\n"
+		}
+		data = append([]byte(sep), data...)
+	}
+	return o.writeStream(data)
+}
+
+// endStream writes the trailing newline after the last of n objects.
+func (o *ioOptions) endStream(n int) error {
+	if n == 0 || !o.trailingNewline {
+		return nil
+	}
+	return o.writeStream([]byte("\n"))
+}
+
+func (o *ioOptions) writeStream(data []byte) error {
+	if o.preserveLineEndings && o.crlf {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	var w io.Writer = os.Stdout
+	if o.stdout != nil {
+		w = o.stdout
+	}
+	_, err := w.Write(data)
+	return err
+}
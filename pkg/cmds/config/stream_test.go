@@ -0,0 +1,83 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// TestStreamInvalidFlags checks that --stream fails on invalid flags before
+// the first resource is written to stdout.
+func TestStreamInvalidFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		newCmd  func() *cobra.Command
+		fixture string
+		args    []string
+	}{
+		{name: "capa node counts", newCmd: NewCmdCAPA, fixture: "testdata/eks.yaml", args: []string{"--min-node-count=5", "--max-node-count=2"}},
+		{name: "capa load balancer scheme", newCmd: NewCmdCAPA, fixture: "testdata/eks.yaml", args: []string{"--lb-scheme=public"}},
+		{name: "capa API server argument", newCmd: NewCmdCAPA, fixture: "testdata/eks.yaml", args: []string{"--apiserver-arg=--invalid"}},
+		{name: "capz node counts", newCmd: NewCmdCAPZ, fixture: "testdata/aks.yaml", args: []string{"--user-min-size=6", "--user-max-size=2"}},
+		{name: "capz ClusterResourceSet resource", newCmd: NewCmdCAPZ, fixture: "testdata/aks.yaml", args: []string{"--crs-resource=Pod/x"}},
+	}
+	for _, tt := range tests {
+		for _, failFast := range []string{"true", "false"} {
+			t.Run(tt.name+"/fail-fast="+failFast, func(t *testing.T) {
+				f, err := os.Open(tt.fixture)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				stdin := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = stdin }()
+
+				r, w, err := os.Pipe()
+				if err != nil {
+					t.Fatal(err)
+				}
+				stdout := os.Stdout
+				os.Stdout = w
+				defer func() { os.Stdout = stdout }()
+				done := make(chan []byte)
+				go func() {
+					data, _ := io.ReadAll(r)
+					done <- data
+				}()
+
+				cmd := tt.newCmd()
+				cmd.SetArgs(append([]string{"--stream", "--quiet", "--fail-fast=" + failFast}, tt.args...))
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				err = cmd.Execute()
+				_ = w.Close()
+				out := <-done
+				if err == nil {
+					t.Error("Execute() succeeded with invalid flags")
+				}
+				if len(out) > 0 {
+					t.Errorf("--stream wrote %q to stdout before failing", out)
+				}
+			})
+		}
+	}
+}
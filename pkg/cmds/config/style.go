@@ -0,0 +1,124 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	yamlv3 "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// restyle re-encodes a YAML document after calling fn on its document
+// node. Use walkValues to restyle every scalar value.
+func restyle(data []byte, fn func(doc *yamlv3.Node)) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	fn(&doc)
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func walkValues(n *yamlv3.Node, fn func(n *yamlv3.Node)) {
+	switch n.Kind {
+	case yamlv3.ScalarNode:
+		fn(n)
+	case yamlv3.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			walkValues(n.Content[i], fn)
+		}
+	default:
+		for _, c := range n.Content {
+			walkValues(c, fn)
+		}
+	}
+}
+
+// metadataFieldOrder is the order of the leading metadata fields set by
+// reorderMetadata. Other fields follow in their existing order.
+var metadataFieldOrder = []string{"name", "generateName", "namespace", "labels", "annotations"}
+
+// reorderMetadata orders the fields of the top-level metadata of the
+// document by metadataFieldOrder, instead of alphabetically.
+func reorderMetadata(doc *yamlv3.Node) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return
+	}
+	root := doc.Content[0]
+	var meta *yamlv3.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "metadata" {
+			meta = root.Content[i+1]
+		}
+	}
+	if meta == nil || meta.Kind != yamlv3.MappingNode {
+		return
+	}
+
+	rank := func(key string) int {
+		for i, k := range metadataFieldOrder {
+			if k == key {
+				return i
+			}
+		}
+		return len(metadataFieldOrder)
+	}
+	type field struct{ key, value *yamlv3.Node }
+	fields := make([]field, 0, len(meta.Content)/2)
+	for i := 0; i+1 < len(meta.Content); i += 2 {
+		fields = append(fields, field{meta.Content[i], meta.Content[i+1]})
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return rank(fields[i].key.Value) < rank(fields[j].key.Value)
+	})
+	meta.Content = meta.Content[:0]
+	for _, f := range fields {
+		meta.Content = append(meta.Content, f.key, f.value)
+	}
+}
+
+// setLiteralStyle writes multi-line strings in literal block style instead
+// of an escaped double-quoted string.
+func setLiteralStyle(n *yamlv3.Node) {
+	if n.ShortTag() == "!!str" && strings.Contains(strings.TrimRight(n.Value, "\n"), "\n") {
+		n.Style = yamlv3.LiteralStyle
+	}
+}
+
+// normalizeStyle writes booleans, numbers and nulls plain and strings
+// double-quoted. The resolved tag of a node is kept, so a string that looks
+// like a boolean stays a string.
+func normalizeStyle(n *yamlv3.Node) {
+	switch n.ShortTag() {
+	case "!!str":
+		n.Style = yamlv3.DoubleQuotedStyle
+	case "!!bool", "!!int", "!!float", "!!null":
+		n.Style = 0
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+	yamlv3 "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+func TestNormalizeStyle(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "cluster.x-k8s.io/v1beta1",
+		"kind":       "MachinePool",
+		"metadata": map[string]any{
+			"name": "default",
+			"annotations": map[string]any{
+				"cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size": "2",
+				"example.com/enabled": "true",
+			},
+		},
+		"spec": map[string]any{
+			"replicas": int64(2),
+			"paused":   false,
+			"ratio":    0.5,
+			"template": map[string]any{
+				"spec": map[string]any{
+					"version": "v1.29.0",
+					"note":    nil,
+					"args":    []any{"--v", "2", int64(3)},
+				},
+			},
+		},
+	}}
+
+	var o ioOptions
+	o.normalizeStyle = true
+	out, err := o.marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`kind: "MachinePool"`,
+		`name: "default"`,
+		`cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size: "2"`,
+		`example.com/enabled: "true"`,
+		`replicas: 2`,
+		`paused: false`,
+		`ratio: 0.5`,
+		`version: "v1.29.0"`,
+		`note: null`,
+		`- "2"`,
+		`- 3`,
+	} {
+		if !strings.Contains(string(out), line+"\n") {
+			t.Errorf("output is missing %q:\n%s", line, out)
+		}
+	}
+
+	var got map[string]any
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	want, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantObj map[string]any
+	if err := yaml.Unmarshal(want, &wantObj); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantObj) {
+		t.Errorf("round trip changed the values:\n%s", out)
+	}
+
+	again, err := restyle(out, func(doc *yamlv3.Node) {
+		walkValues(doc, normalizeStyle)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(out) {
+		t.Errorf("normalizing twice is not stable:\n%s\nvs\n%s", out, again)
+	}
+}
+
+// TestReorderMetadata checks that the metadata fields come out in the same
+// canonical order whatever their order in the input.
+func TestReorderMetadata(t *testing.T) {
+	inputs := []string{
+		`apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  annotations:
+    example.com/owner: platform
+  labels:
+    tier: workload
+  name: capi
+  namespace: default
+  finalizers:
+  - cluster.cluster.x-k8s.io
+`,
+		`apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  finalizers:
+  - cluster.cluster.x-k8s.io
+  namespace: default
+  labels:
+    tier: workload
+  name: capi
+  annotations:
+    example.com/owner: platform
+`,
+	}
+	want := `apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: capi
+  namespace: default
+  labels:
+    tier: workload
+  annotations:
+    example.com/owner: platform
+  finalizers:
+    - cluster.cluster.x-k8s.io
+`
+	o := ioOptions{reorderMetadata: true}
+	for i, in := range inputs {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(in), &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		for run := 0; run < 2; run++ {
+			out, err := o.marshal(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != want {
+				t.Errorf("input %d, run %d: marshal() =\n%s\nwant:\n%s", i, run, out, want)
+			}
+		}
+	}
+}
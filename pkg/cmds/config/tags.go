@@ -0,0 +1,113 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// tagProfiles are the tag sets selected with --tag-profile, holding the
+// tags required on every AWS resource of the environment.
+var tagProfiles = map[string]map[string]string{
+	"dev": {
+		"environment": "dev",
+		"criticality": "low",
+	},
+	"staging": {
+		"environment": "staging",
+		"criticality": "medium",
+	},
+	"prod": {
+		"environment": "prod",
+		"criticality": "high",
+	},
+}
+
+// awsTagPaths maps the CAPA kinds to the path of their additional tags.
+var awsTagPaths = map[string][]string{
+	awsManagedControlPlaneKind: {"spec", "additionalTags"},
+	awsManagedMachinePoolKind:  {"spec", "additionalTags"},
+	awsClusterKind:             {"spec", "additionalTags"},
+	"AWSMachinePool":           {"spec", "additionalTags"},
+	"AWSMachineTemplate":       {"spec", "template", "spec", "additionalTags"},
+}
+
+// resolveTags returns the tags of the profile merged with tags, where tags
+// take precedence.
+func resolveTags(profile string, tags map[string]string) (map[string]string, error) {
+	result := make(map[string]string)
+	if profile != "" {
+		p, ok := tagProfiles[profile]
+		if !ok {
+			names := make([]string, 0, len(tagProfiles))
+			for name := range tagProfiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown tag profile %q, available profiles: %s", profile, strings.Join(names, ", "))
+		}
+		for k, v := range p {
+			result[k] = v
+		}
+	}
+	for k, v := range tags {
+		if k == "" || strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return nil, fmt.Errorf("invalid tag key %q, keys must not be empty or use the reserved aws: prefix", k)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// parseTags parses tags given in key=value format. The entries are applied
+// in order, so the last value of a repeated key wins.
+func parseTags(entries []string) (map[string]string, error) {
+	tags := make(map[string]string, len(entries))
+	for _, s := range entries {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", s)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// setAWSTags merges tags into the additional tags of ri. It returns false
+// if ri has no additional tags.
+func setAWSTags(ri parser.ResourceInfo, tags map[string]string) (bool, error) {
+	path, ok := awsTagPaths[ri.Object.GetKind()]
+	if !ok {
+		return false, nil
+	}
+	existing, _, err := unstructured.NestedStringMap(ri.Object.UnstructuredContent(), path...)
+	if err != nil {
+		return true, err
+	}
+	if existing == nil {
+		existing = make(map[string]string, len(tags))
+	}
+	for k, v := range tags {
+		existing[k] = v
+	}
+	return true, setField(ri, existing, path...)
+}
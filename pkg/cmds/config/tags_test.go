@@ -0,0 +1,146 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestParseTagsLastWins(t *testing.T) {
+	got, err := parseTags([]string{"env=dev", "team=infra", "env=prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"env": "prod", "team": "infra"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTags() = %v, want %v", got, want)
+	}
+}
+
+// TestCAPATagFlagsLastWins checks that the last value of a key repeated in
+// --tag and --set-tags wins, and that --set-tags wins over --tag.
+func TestCAPATagFlagsLastWins(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.yaml")
+	if err := os.WriteFile(in, []byte(capaManifestYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.yaml")
+
+	cmd := NewCmdCAPA()
+	cmd.SetArgs([]string{
+		"-f", in, "-o", out, "--quiet",
+		"--tag", "env=dev", "--tag", "owner=ops", "--tag", "env=prod",
+		"--set-tags", "team=a", "--set-tags", "owner=platform", "--set-tags", "team=b",
+	})
+	cmd.SilenceUsage = true
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"env": "prod", "owner": "platform", "team": "b"}
+	var found bool
+	err = parser.ProcessResources(data, func(ri parser.ResourceInfo) error {
+		if ri.Object.GetKind() != awsManagedControlPlaneKind {
+			return nil
+		}
+		found = true
+		got, _, err := unstructured.NestedStringMap(ri.Object.Object, "spec", "additionalTags")
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("spec.additionalTags = %v, want %v", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("AWSManagedControlPlane not found in the output")
+	}
+}
+
+func TestSetAWSTags(t *testing.T) {
+	tags := map[string]string{"team": "infra", "env": "prod"}
+	tests := []struct {
+		name      string
+		ri        parser.ResourceInfo
+		path      []string
+		wantFound bool
+		want      map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "merged into existing tags",
+			ri:        newResourceInfo("controlplane.cluster.x-k8s.io/v1beta2", awsManagedControlPlaneKind, map[string]any{"additionalTags": map[string]any{"env": "dev", "owner": "ops"}}),
+			path:      []string{"spec", "additionalTags"},
+			wantFound: true,
+			want:      map[string]string{"team": "infra", "env": "prod", "owner": "ops"},
+		},
+		{
+			name:      "machine template",
+			ri:        newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", "AWSMachineTemplate", nil),
+			path:      []string{"spec", "template", "spec", "additionalTags"},
+			wantFound: true,
+			want:      tags,
+		},
+		{
+			name: "kind without tags",
+			ri:   newResourceInfo("cluster.x-k8s.io/v1beta1", clusterKind, nil),
+			path: []string{"spec", "additionalTags"},
+		},
+		{
+			name:      "scalar tags",
+			ri:        newResourceInfo("infrastructure.cluster.x-k8s.io/v1beta2", awsManagedMachinePoolKind, map[string]any{"additionalTags": "invalid"}),
+			wantFound: true,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := setAWSTags(tt.ri, tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setAWSTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if found != tt.wantFound {
+				t.Errorf("setAWSTags() found = %v, want %v", found, tt.wantFound)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, _, _ := unstructured.NestedStringMap(tt.ri.Object.Object, tt.path...)
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tags = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
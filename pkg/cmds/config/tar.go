@@ -0,0 +1,136 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// tarEntry is a manifest file read from a tar archive.
+type tarEntry struct {
+	name  string
+	mode  int64
+	count int // number of resources in the entry
+}
+
+// readTar returns the .yaml and .yml entries of a tar or tar.gz archive, in
+// entry order, joined into a single multi-document stream.
+func readTar(path string) ([]byte, []tarEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var out bytes.Buffer
+	var entries []tarEntry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		ext := filepath.Ext(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s in %s: %w", hdr.Name, path, err)
+		}
+
+		var count int
+		if err := parser.ProcessResources(data, func(ri parser.ResourceInfo) error {
+			count++
+			return nil
+		}); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s in %s: %w", hdr.Name, path, err)
+		}
+		entries = append(entries, tarEntry{name: hdr.Name, mode: hdr.Mode, count: count})
+
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		if out.Len() > 0 {
+			out.WriteString("---\n")
+		}
+		out.Write(data)
+	}
+	return out.Bytes(), entries, nil
+}
+
+// writeTar writes one entry per manifest file to a tar archive at path,
+// gzip compressed if path ends with .gz or .tgz.
+func writeTar(path string, entries []tarEntry, files [][]byte) (err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	var w io.Writer = f
+	if strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz") {
+		gz := gzip.NewWriter(f)
+		defer func() {
+			if cerr := gz.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = gz
+	}
+
+	tw := tar.NewWriter(w)
+	for i, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: e.name,
+			Mode: e.mode,
+			Size: int64(len(files[i])),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[i]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,113 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestTar writes the documents of the kinds of the eks.yaml fixture
+// to a tar archive, one entry per kind.
+func writeTestTar(t *testing.T, path string, kinds ...string) {
+	t.Helper()
+	docs := readFixtureDocuments(t, "eks.yaml")
+	entries := make([]tarEntry, 0, len(kinds))
+	files := make([][]byte, 0, len(kinds))
+	for _, kind := range kinds {
+		entries = append(entries, tarEntry{name: kind + ".yaml", mode: 0o644})
+		files = append(files, joinDocuments(docs, kind))
+	}
+	if err := writeTar(path, entries, files); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTarOutputWrittenLast checks that --tar-output is only written once
+// all validations passed, so that a failed run leaves no archive behind.
+func TestTarOutputWrittenLast(t *testing.T) {
+	t.Setenv("VPC_CIDR", "10.0.0.0/16")
+	tests := []struct {
+		name    string
+		kinds   []string
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			kinds: []string{clusterKind, awsManagedControlPlaneKind, machinePoolKind, awsManagedMachinePoolKind},
+		},
+		{
+			name:    "VPC CIDR without control plane",
+			kinds:   []string{clusterKind, machinePoolKind, awsManagedMachinePoolKind},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		for _, failFast := range []string{"true", "false"} {
+			t.Run(tt.name+"/fail-fast="+failFast, func(t *testing.T) {
+				dir := t.TempDir()
+				in := filepath.Join(dir, "in.tar")
+				writeTestTar(t, in, tt.kinds...)
+				out := filepath.Join(dir, "out.tar")
+
+				cmd := NewCmdCAPA()
+				cmd.SetArgs([]string{"--tar", in, "--tar-output", out, "--fail-fast=" + failFast, "--quiet"})
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				err := cmd.Execute()
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Execute() error = %v, want error %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					if _, err := os.Stat(out); !os.IsNotExist(err) {
+						t.Errorf("--tar-output exists after a failed run, stat error = %v", err)
+					}
+					return
+				}
+				_, entries, err := readTar(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != len(tt.kinds) {
+					t.Errorf("--tar-output has %d entries, want %d", len(entries), len(tt.kinds))
+				}
+			})
+		}
+	}
+}
+
+// TestTarOutputDryRun checks that --dry-run writes neither --tar-output nor
+// stdout.
+func TestTarOutputDryRun(t *testing.T) {
+	t.Setenv("VPC_CIDR", "10.0.0.0/16")
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.tar")
+	writeTestTar(t, in, clusterKind, awsManagedControlPlaneKind, machinePoolKind, awsManagedMachinePoolKind)
+	out := filepath.Join(dir, "out.tar")
+
+	cmd := NewCmdCAPA()
+	cmd.SetArgs([]string{"--tar", in, "--tar-output", out, "--dry-run", "--quiet"})
+	cmd.SilenceUsage = true
+	stdout := captureStdout(t, cmd.Execute)
+	if len(stdout) > 0 {
+		t.Errorf("--dry-run wrote %q to stdout", stdout)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("--dry-run wrote --tar-output, stat error = %v", err)
+	}
+}
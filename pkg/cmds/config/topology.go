@@ -0,0 +1,63 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// bumpTopologyVersion increments the minor version of spec.topology.version
+// of a ClusterClass based Cluster and resets the patch version, so that the
+// topology controller upgrades the cluster to the next Kubernetes minor
+// release.
+func bumpTopologyVersion(ri parser.ResourceInfo) error {
+	topology, ok, err := unstructured.NestedMap(ri.Object.UnstructuredContent(), "spec", "topology")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s %s has no spec.topology to bump the version of", ri.Object.GetKind(), ri.Object.GetName())
+	}
+	current, _, err := unstructured.NestedString(topology, "version")
+	if err != nil {
+		return err
+	}
+	next, err := nextMinorVersion(current)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", ri.Object.GetKind(), ri.Object.GetName(), err)
+	}
+	return setField(ri, next, "spec", "topology", "version")
+}
+
+// nextMinorVersion returns the next minor version of a semver version like
+// v1.28.4, keeping the leading v.
+func nextMinorVersion(version string) (string, error) {
+	v, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return "", fmt.Errorf("invalid topology version %q: %w", version, err)
+	}
+	next := v.IncMinor()
+	if strings.HasPrefix(version, "v") {
+		return "v" + next.String(), nil
+	}
+	return next.String(), nil
+}
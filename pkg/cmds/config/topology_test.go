@@ -0,0 +1,106 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func TestBumpTopologyVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    map[string]any
+		want    string
+		wantErr bool
+	}{
+		{name: "patch reset", spec: map[string]any{"topology": map[string]any{"version": "v1.28.4"}}, want: "v1.29.0"},
+		{name: "without leading v", spec: map[string]any{"topology": map[string]any{"version": "1.29.0"}}, want: "1.30.0"},
+		{name: "pre-release", spec: map[string]any{"topology": map[string]any{"version": "v1.30.0-rc.1"}}, want: "v1.31.0"},
+		{name: "no topology", spec: map[string]any{"clusterNetwork": map[string]any{}}, wantErr: true},
+		{name: "no version", spec: map[string]any{"topology": map[string]any{"class": "quick-start"}}, wantErr: true},
+		{name: "not semver", spec: map[string]any{"topology": map[string]any{"version": "v1.28"}}, wantErr: true},
+		{name: "not a version", spec: map[string]any{"topology": map[string]any{"version": "latest"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "cluster.x-k8s.io/v1beta1",
+				"kind":       clusterKind,
+				"metadata":   map[string]any{"name": "capi"},
+				"spec":       tt.spec,
+			}}
+			err := bumpTopologyVersion(parser.ResourceInfo{Object: obj})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bumpTopologyVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got, _, _ := unstructured.NestedString(obj.Object, "spec", "topology", "version"); got != tt.want {
+				t.Errorf("spec.topology.version = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoreBumpVersion(t *testing.T) {
+	const in = `apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: capi
+  namespace: default
+spec:
+  topology:
+    class: quick-start
+    version: v1.28.4
+---
+apiVersion: cluster.x-k8s.io/v1beta1
+kind: MachineDeployment
+metadata:
+  name: capi-md-0
+  namespace: default
+spec:
+  clusterName: capi
+`
+	o := coreOptions{bumpVersion: true}
+	var version string
+	err := parser.ProcessResources([]byte(in), func(ri parser.ResourceInfo) error {
+		if err := o.apply(ri); err != nil {
+			return err
+		}
+		if ri.Object.GetKind() == clusterKind {
+			version, _, _ = unstructured.NestedString(ri.Object.Object, "spec", "topology", "version")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "v1.29.0" {
+		t.Errorf("spec.topology.version = %q, want %q", version, "v1.29.0")
+	}
+	if err := o.validate(); err != nil {
+		t.Errorf("validate() error = %v", err)
+	}
+
+	if err := o.validateKinds(map[string]bool{machineDeploymentKind: true}); err == nil {
+		t.Error("validateKinds() accepted --bump-version without a Cluster")
+	}
+}
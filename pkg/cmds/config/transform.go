@@ -0,0 +1,196 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"kmodules.xyz/client-go/tools/parser"
+	"sigs.k8s.io/yaml"
+)
+
+// transformOptions holds the generic transforms applied to every resource.
+// Commands run it after the provider mutations, so these transforms win over
+// values set by the provider specific helpers. Labels and annotations are
+// injected first, followed by list appends in the order they are given and
+// the steps of the pipeline file.
+type transformOptions struct {
+	labels      map[string]string
+	annotations map[string]string
+	appends     []string
+	pipeline    string
+
+	fixedSizeCleanup bool
+	prepareMove      bool
+	pruneDefaults    bool
+
+	// keepDefaults are the fields kept by --prune-defaults by kind, set
+	// with keepFlagDefaults.
+	keepDefaults map[string]map[string]bool
+
+	moveObjects   map[moveObject]bool
+	moveRefs      []moveRef
+	pipelineSteps []pipelineStep
+}
+
+func (o *transformOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringToStringVar(&o.labels, "add-labels", nil, "Labels merged into every resource after the provider mutations")
+	fs.StringToStringVar(&o.annotations, "add-annotations", nil, "Annotations merged into every resource after the provider mutations")
+	fs.BoolVar(&o.fixedSizeCleanup, "fixed-size-cleanup", false, "Remove the cluster autoscaler annotations from pools whose min and max size are equal")
+	fs.BoolVar(&o.pruneDefaults, "prune-defaults", false, "Remove fields set to their well known default value from the recognized kinds")
+	fs.BoolVar(&o.prepareMove, "prepare-move", false, "Strip status and add the clusterctl.cluster.x-k8s.io/move label to non Cluster API resources, for use with clusterctl move")
+	fs.StringArrayVar(&o.appends, "append", nil, "Append a value to the list field of every resource of the kind, in Kind:dotted.path=value format (repeatable)")
+	fs.StringVar(&o.pipeline, "pipeline", "", "Path to a YAML list of transform steps run in order on every resource after --append, each with an optional kind, an op (set, unset, append or label) and the path, key and value of the op")
+}
+
+// reset clears the state collected by apply, so that the input can be
+// processed again.
+func (o *transformOptions) reset() {
+	o.moveObjects = nil
+	o.moveRefs = nil
+	o.pipelineSteps = nil
+}
+
+func (o *transformOptions) apply(ri parser.ResourceInfo) error {
+	if err := validateLabels(o.labels); err != nil {
+		return err
+	}
+	if o.pipeline != "" && o.pipelineSteps == nil {
+		steps, err := readPipeline(o.pipeline)
+		if err != nil {
+			return err
+		}
+		o.pipelineSteps = steps
+	}
+	// Skipped resources are still part of the manifest to move, so they
+	// are recorded before the skip check.
+	if o.prepareMove {
+		if o.moveObjects == nil {
+			o.moveObjects = make(map[moveObject]bool)
+		}
+		o.moveObjects[moveObject{kind: ri.Object.GetKind(), namespace: ri.Object.GetNamespace(), name: ri.Object.GetName()}] = true
+		o.moveRefs = append(o.moveRefs, moveRefs(ri.Object)...)
+	}
+	if skipped(ri.Object, skipTransform) {
+		return nil
+	}
+	for k, v := range o.labels {
+		if err := setField(ri, v, "metadata", "labels", k); err != nil {
+			return err
+		}
+	}
+	for k, v := range o.annotations {
+		if errs := kvalidation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if err := setField(ri, v, "metadata", "annotations", k); err != nil {
+			return err
+		}
+	}
+	if o.fixedSizeCleanup {
+		switch ri.Object.GetKind() {
+		case machinePoolKind, machineDeploymentKind:
+			removeFixedSizeAutoscaling(ri)
+		}
+	}
+	for _, s := range o.appends {
+		if err := appendField(ri, s); err != nil {
+			return err
+		}
+	}
+	if err := applyPipeline(ri, o.pipelineSteps); err != nil {
+		return err
+	}
+	if o.pruneDefaults {
+		pruneDefaults(ri.Object, o.keepDefaults)
+	}
+	if o.prepareMove {
+		prepareMove(ri.Object)
+	}
+	return nil
+}
+
+// validate checks the emitted resources after processing.
+func (o *transformOptions) validate() error {
+	if o.prepareMove {
+		return validateMoveSet(o.moveObjects, o.moveRefs)
+	}
+	return nil
+}
+
+// appendField appends the value of a Kind:path=value expression to the list
+// at path, creating the list if it doesn't exist yet.
+func appendField(ri parser.ResourceInfo, expr string) error {
+	ref, s, ok := strings.Cut(expr, "=")
+	if !ok {
+		return fmt.Errorf("invalid append %q, expected Kind:path=value", expr)
+	}
+	field, err := parseFieldRef(ref)
+	if err != nil {
+		return err
+	}
+	if ri.Object.GetKind() != field.kind {
+		return nil
+	}
+	value, err := parseValue(s)
+	if err != nil {
+		return err
+	}
+
+	list, _, err := unstructured.NestedSlice(ri.Object.UnstructuredContent(), field.path...)
+	if err != nil {
+		return fmt.Errorf("failed to append to %s: %w", field, err)
+	}
+	return setField(ri, append(list, value), field.path...)
+}
+
+// parseValue parses s as a YAML value, so that numbers, booleans, lists and
+// maps keep their type. Whole numbers are returned as int64 as required by
+// unstructured objects.
+func parseValue(s string) (any, error) {
+	var v any
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return s, nil
+	}
+	if v == nil && s != "null" {
+		return s, nil
+	}
+	return toUnstructuredValue(v), nil
+}
+
+func toUnstructuredValue(v any) any {
+	switch u := v.(type) {
+	case float64:
+		if u == math.Trunc(u) {
+			return int64(u)
+		}
+	case map[string]any:
+		for k, e := range u {
+			u[k] = toUnstructuredValue(e)
+		}
+	case []any:
+		for i, e := range u {
+			u[i] = toUnstructuredValue(e)
+		}
+	}
+	return v
+}
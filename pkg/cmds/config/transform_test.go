@@ -0,0 +1,214 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+	"sigs.k8s.io/yaml"
+)
+
+const machinePoolYAML = `apiVersion: cluster.x-k8s.io/v1beta1
+kind: MachinePool
+metadata:
+  name: capi-pool-0
+  namespace: default
+spec:
+  clusterName: capi
+`
+
+// TestTransformAfterProviderMutations checks that the injected metadata is
+// applied after the provider mutations and so wins over their values.
+func TestTransformAfterProviderMutations(t *testing.T) {
+	const maxSizeKey = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+	transformOpts := transformOptions{
+		labels:      map[string]string{"team": "infra"},
+		annotations: map[string]string{maxSizeKey: "10"},
+	}
+	var w warnings
+	provider := func(ri parser.ResourceInfo) error {
+		return SetMPConfiguration(ri, "default", 1, 3, &w)
+	}
+
+	ioOpts := ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing}
+	out, err := ioOpts.processResources([]byte(machinePoolYAML), provider, transformOpts.apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Metadata.Name != "default" {
+		t.Errorf("name = %q, want %q", got.Metadata.Name, "default")
+	}
+	if v := got.Metadata.Annotations[maxSizeKey]; v != "10" {
+		t.Errorf("annotation %s = %q, want the injected value %q", maxSizeKey, v, "10")
+	}
+	if v := got.Metadata.Labels["team"]; v != "infra" {
+		t.Errorf("label team = %q, want %q", v, "infra")
+	}
+}
+
+func TestTransformInvalidLabelKey(t *testing.T) {
+	transformOpts := transformOptions{labels: map[string]string{"in valid": "x"}}
+	ioOpts := ioOptions{outputFormat: outputFormatYAML, fieldMode: fieldModeCreateIfMissing}
+	if _, err := ioOpts.processResources([]byte(machinePoolYAML), transformOpts.apply); err == nil {
+		t.Error("processResources() accepted an invalid label key")
+	}
+}
+
+func TestTransformFixedSizeCleanup(t *testing.T) {
+	in, err := os.ReadFile("testdata/fixed-size.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		cleanup bool
+		want    map[string]map[string]string
+	}{
+		{
+			name: "disabled",
+			want: map[string]map[string]string{
+				"fixed": {
+					autoscalerMinSizeAnnotation: "3",
+					autoscalerMaxSizeAnnotation: "3",
+					replicasManagedByAnnotation: "external-autoscaler",
+				},
+				"autoscaled": {
+					autoscalerMinSizeAnnotation: "1",
+					autoscalerMaxSizeAnnotation: "5",
+					replicasManagedByAnnotation: "external-autoscaler",
+				},
+				"fixed-md": {
+					autoscalerMinSizeAnnotation: "2",
+					autoscalerMaxSizeAnnotation: "2",
+					"example.com/owner":         "platform",
+				},
+			},
+		},
+		{
+			name:    "enabled",
+			cleanup: true,
+			want: map[string]map[string]string{
+				"fixed": nil,
+				"autoscaled": {
+					autoscalerMinSizeAnnotation: "1",
+					autoscalerMaxSizeAnnotation: "5",
+					replicasManagedByAnnotation: "external-autoscaler",
+				},
+				"fixed-md": {
+					"example.com/owner": "platform",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformOpts := transformOptions{fixedSizeCleanup: tt.cleanup}
+			got := make(map[string]map[string]string)
+			err := parser.ProcessResources(in, func(ri parser.ResourceInfo) error {
+				if err := transformOpts.apply(ri); err != nil {
+					return err
+				}
+				got[ri.Object.GetName()] = ri.Object.GetAnnotations()
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("annotations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const moveClusterYAML = `apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: c1
+  namespace: default
+spec:
+  infrastructureRef:
+    kind: KubevirtCluster
+    name: c1
+`
+
+const moveSkippedInfraYAML = `apiVersion: infrastructure.cluster.x-k8s.io/v1alpha1
+kind: KubevirtCluster
+metadata:
+  name: c1
+  namespace: default
+  annotations:
+    capi-config.appscode.com/skip: transform
+status:
+  ready: true
+`
+
+// TestTransformPrepareMoveSkipped checks that resources skipped with the
+// skip annotation still count as part of the manifest to move, whatever
+// their position in the input and with --prune-defaults.
+func TestTransformPrepareMoveSkipped(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		opts transformOptions
+	}{
+		{name: "cluster first", in: moveClusterYAML + "---\n" + moveSkippedInfraYAML, opts: transformOptions{prepareMove: true}},
+		{name: "skipped first", in: moveSkippedInfraYAML + "---\n" + moveClusterYAML, opts: transformOptions{prepareMove: true}},
+		{name: "cluster first with prune defaults", in: moveClusterYAML + "---\n" + moveSkippedInfraYAML, opts: transformOptions{prepareMove: true, pruneDefaults: true}},
+		{name: "skipped first with prune defaults", in: moveSkippedInfraYAML + "---\n" + moveClusterYAML, opts: transformOptions{prepareMove: true, pruneDefaults: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var skippedObj *unstructured.Unstructured
+			err := parser.ProcessResources([]byte(tt.in), func(ri parser.ResourceInfo) error {
+				if err := tt.opts.apply(ri); err != nil {
+					return err
+				}
+				if ri.Object.GetKind() == "KubevirtCluster" {
+					skippedObj = ri.Object
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.opts.validate(); err != nil {
+				t.Errorf("validate() error = %v", err)
+			}
+			if _, ok := skippedObj.GetLabels()[clusterctlMoveLabel]; ok {
+				t.Errorf("skipped resource has the %s label", clusterctlMoveLabel)
+			}
+			if _, ok, _ := unstructured.NestedFieldNoCopy(skippedObj.Object, "status"); !ok {
+				t.Error("status of the skipped resource is stripped")
+			}
+		})
+	}
+}
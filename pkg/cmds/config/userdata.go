@@ -0,0 +1,159 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+// bootstrapUserDataPath is where the extra user-data is written on the node
+// before bootstrap.
+const bootstrapUserDataPath = "/etc/capi-config/bootstrap-user-data.sh"
+
+// bootstrapConfigPaths maps the bootstrap config kinds to the path of their
+// bootstrap config spec and the field holding the commands run before the
+// node is bootstrapped.
+var bootstrapConfigPaths = map[string]struct {
+	spec     []string
+	commands string
+}{
+	kubeadmControlPlaneKind: {spec: []string{"spec", "kubeadmConfigSpec"}, commands: "preKubeadmCommands"},
+	"KubeadmConfigTemplate": {spec: []string{"spec", "template", "spec"}, commands: "preKubeadmCommands"},
+	"EKSConfigTemplate":     {spec: []string{"spec", "template", "spec"}, commands: "preBootstrapCommands"},
+}
+
+// readBootstrapUserData returns the content of the user-data file encoded
+// as base64.
+func readBootstrapUserData(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bootstrap user-data: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// setBootstrapUserData adds the base64 encoded user-data as a file of the
+// bootstrap config of ri and runs it before the node is bootstrapped. It
+// returns false if ri is not a bootstrap config.
+func setBootstrapUserData(ri parser.ResourceInfo, content string) (bool, error) {
+	if _, ok := bootstrapConfigPaths[ri.Object.GetKind()]; !ok {
+		return false, nil
+	}
+	return true, addBootstrapFile(ri, bootstrapFile{
+		path:        bootstrapUserDataPath,
+		permissions: "0755",
+		content:     content,
+		command:     bootstrapUserDataPath,
+	})
+}
+
+// bootstrapFile is a file written on the node before bootstrap, and the
+// command run afterwards to apply it.
+type bootstrapFile struct {
+	path        string
+	permissions string
+	content     string // base64 encoded
+	command     string
+}
+
+// addBootstrapFile adds f to the files of the bootstrap config of ri and
+// its command, if any, to the commands run before the node is bootstrapped.
+// A file already at the path of f is replaced and a command already in the
+// list is kept, so that running the command again on its own output doesn't
+// add either twice.
+func addBootstrapFile(ri parser.ResourceInfo, f bootstrapFile) error {
+	paths := bootstrapConfigPaths[ri.Object.GetKind()]
+	filesPath := append(append([]string{}, paths.spec...), "files")
+	files, _, err := unstructured.NestedSlice(ri.Object.UnstructuredContent(), filesPath...)
+	if err != nil {
+		return err
+	}
+	file := map[string]any{
+		"path":        f.path,
+		"owner":       "root:root",
+		"permissions": f.permissions,
+		"encoding":    "base64",
+		"content":     f.content,
+	}
+	i := slices.IndexFunc(files, func(v any) bool {
+		m, ok := v.(map[string]any)
+		return ok && m["path"] == f.path
+	})
+	if i >= 0 {
+		files[i] = file
+	} else {
+		files = append(files, file)
+	}
+	if err := setField(ri, files, filesPath...); err != nil {
+		return err
+	}
+	if f.command == "" {
+		return nil
+	}
+
+	commandsPath := append(append([]string{}, paths.spec...), paths.commands)
+	commands, _, err := unstructured.NestedSlice(ri.Object.UnstructuredContent(), commandsPath...)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(commands, any(f.command)) {
+		return nil
+	}
+	return setField(ri, append(commands, f.command), commandsPath...)
+}
+
+const (
+	registryMirrorConfigPath = "/etc/containerd/config.toml"
+	caBundlePath             = "/usr/local/share/ca-certificates/capi-config-ca-bundle.crt"
+)
+
+// airGapConfigKinds are the bootstrap config kinds the registry mirror
+// config and the CA bundle are added to.
+var airGapConfigKinds = map[string]bool{
+	kubeadmControlPlaneKind: true,
+	"KubeadmConfigTemplate": true,
+}
+
+// readAirGapFiles returns the bootstrap files of the CA bundle and the
+// containerd config with the registry mirrors. Empty paths are skipped.
+func readAirGapFiles(caBundle, mirrorConfig string) ([]bootstrapFile, error) {
+	var files []bootstrapFile
+	for _, f := range []struct {
+		src string
+		bootstrapFile
+	}{
+		{src: caBundle, bootstrapFile: bootstrapFile{path: caBundlePath, permissions: "0644", command: "update-ca-certificates"}},
+		{src: mirrorConfig, bootstrapFile: bootstrapFile{path: registryMirrorConfigPath, permissions: "0644", command: "systemctl restart containerd"}},
+	} {
+		if f.src == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.src, err)
+		}
+		f.content = base64.StdEncoding.EncodeToString(data)
+		files = append(files, f.bootstrapFile)
+	}
+	return files, nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// warnings collects the soft warnings of a run. They are printed as one
+// deduplicated block at the end of the run, suppressed with --quiet or
+// returned as an error with --strict.
+type warnings struct {
+	msgs []string
+}
+
+func (w *warnings) add(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if !slices.Contains(w.msgs, msg) {
+		w.msgs = append(w.msgs, msg)
+	}
+}
+
+func (w *warnings) reset() {
+	w.msgs = nil
+}
+
+// flush prints the collected warnings to stderr, unless quiet, or returns
+// them as an error if strict. The collected warnings are cleared.
+func (w *warnings) flush(quiet, strict bool) error {
+	defer w.reset()
+	if len(w.msgs) == 0 {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("warnings treated as errors:\n  - %s", strings.Join(w.msgs, "\n  - "))
+	}
+	if quiet {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("Warnings:\n")
+	for _, msg := range w.msgs {
+		fmt.Fprintf(&b, "  - %s\n", msg)
+	}
+	_, err := os.Stderr.WriteString(b.String())
+	return err
+}
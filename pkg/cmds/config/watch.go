@@ -0,0 +1,103 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the input file must stay unchanged before it is
+// processed again, so that editors writing a file in several steps trigger a
+// single run.
+const watchDebounce = 200 * time.Millisecond
+
+// run calls fn once, or with --watch every time an input file changes, or
+// with --dir once for every file of the directory. In watch mode a failing
+// run is reported and the next change is awaited.
+func (o *ioOptions) run(runFn func() error) error {
+	fn := func() error {
+		o.warnings.reset()
+		return runFn()
+	}
+	if o.dir != "" || o.inPlace {
+		return o.runDir(fn)
+	}
+	if !o.watch {
+		return fn()
+	}
+	names := make(map[string]bool, len(o.files))
+	for _, f := range o.files {
+		if f == "-" {
+			return errors.New("--watch can't be used with stdin input")
+		}
+		names[filepath.Clean(f)] = true
+	}
+	if len(names) == 0 {
+		return errors.New("--watch requires --file")
+	}
+	label := strings.Join(o.files, ",")
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	// watch the directories, since editors often replace the file instead
+	// of writing it in place
+	for name := range names {
+		if err := w.Add(filepath.Dir(name)); err != nil {
+			return err
+		}
+	}
+
+	runOnce := func() {
+		if err := fn(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: error: %v\n", time.Now().Format(time.TimeOnly), label, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: ok\n", time.Now().Format(time.TimeOnly), label)
+	}
+	runOnce()
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if names[filepath.Clean(e.Name)] && e.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				debounce = time.After(watchDebounce)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-debounce:
+			debounce = nil
+			runOnce()
+		}
+	}
+}
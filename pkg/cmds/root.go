@@ -35,6 +35,9 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(config.NewCmdCAPA())
 	rootCmd.AddCommand(config.NewCmdCAPG())
 	rootCmd.AddCommand(config.NewCmdCAPK())
+	rootCmd.AddCommand(config.NewCmdValidateKubeconfig())
+	rootCmd.AddCommand(config.NewCmdKustomizePlugin())
+	rootCmd.AddCommand(config.NewCmdGet())
 
 	rootCmd.AddCommand(v.NewCmdVersion())
 	rootCmd.AddCommand(NewCmdCompletion())
@@ -0,0 +1,117 @@
+//go:build e2e
+
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package e2e runs the config commands against real provider manifests and
+// a real management cluster. The tests only build with -tags e2e, see
+// hack/e2e.sh.
+package e2e
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+
+	"go.klusters.dev/capi-config/pkg/cmds/config"
+
+	"kmodules.xyz/client-go/tools/parser"
+)
+
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// run runs the command with stdin as input and returns its stdout. The test
+// fails with the stderr of the command if it exits with an error.
+func run(t *testing.T, stdin []byte, name string, args ...string) []byte {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%s %v: %v\n%s", name, args, err, stderr.String())
+	}
+	return stdout.Bytes()
+}
+
+// TestCAPDCluster generates a workload cluster manifest for the Docker
+// provider (CAPD) with clusterctl, runs it through ConfigureCAPA and applies
+// it to the management cluster of the current kubeconfig context. The
+// management cluster is expected to be a kind cluster initialized with
+// clusterctl init --infrastructure docker. The test passes once the Cluster
+// reports Ready, which shows that the manifests written by the tool are
+// accepted and reconciled by the real provider controllers.
+func TestCAPDCluster(t *testing.T) {
+	for _, tool := range []string{"clusterctl", "kubectl"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found in PATH", tool)
+		}
+	}
+	if err := exec.Command("kubectl", "get", "crd", "dockerclusters.infrastructure.cluster.x-k8s.io").Run(); err != nil {
+		t.Skip("no management cluster with the Docker provider, run clusterctl init --infrastructure docker on a kind cluster first")
+	}
+
+	name := env("E2E_CLUSTER_NAME", "capi-config-e2e")
+	namespace := env("E2E_NAMESPACE", "default")
+	timeout := env("E2E_TIMEOUT", "15m")
+
+	in := run(t, nil, "clusterctl", "generate", "cluster", name,
+		"--infrastructure", "docker",
+		"--flavor", env("E2E_FLAVOR", "development"),
+		"--kubernetes-version", env("E2E_KUBERNETES_VERSION", "v1.29.2"),
+		"--control-plane-machine-count", "1",
+		"--worker-machine-count", "1",
+		"--target-namespace", namespace,
+	)
+	out, err := config.ConfigureCAPA(in, config.CAPAOptions{MinNodeCount: 1, MaxNodeCount: 3})
+	if err != nil {
+		t.Fatalf("ConfigureCAPA: %v", err)
+	}
+
+	inResources, err := parser.ListResources(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outResources, err := parser.ListResources(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outResources) != len(inResources) {
+		t.Fatalf("ConfigureCAPA returned %d resources, want %d", len(outResources), len(inResources))
+	}
+
+	t.Cleanup(func() {
+		// deleting the Cluster first lets the controllers tear down the
+		// machines and containers before their templates go away
+		_ = exec.Command("kubectl", "delete", "cluster", name, "--namespace", namespace, "--ignore-not-found", "--timeout", timeout).Run()
+		cmd := exec.Command("kubectl", "delete", "--filename", "-", "--ignore-not-found")
+		cmd.Stdin = bytes.NewReader(out)
+		_ = cmd.Run()
+	})
+	run(t, out, "kubectl", "apply", "--filename", "-")
+	run(t, nil, "kubectl", "wait", "cluster/"+name,
+		"--namespace", namespace,
+		"--for", "condition=Ready",
+		"--timeout", timeout,
+	)
+}